@@ -0,0 +1,150 @@
+package quill
+
+import (
+	"bytes"
+	"html"
+	"strings"
+)
+
+// autoLink wraps the bare http and https URLs in the text of the HTML of a block in links. Text that is already within a
+// link or an inline code element is left as it is. A URL running up to an inline tag that the text continues after (as
+// when only the end of the URL is bold) is not linked because the URL cannot be told apart from the text after it.
+func (vars *renderVars) autoLink(h []byte) []byte {
+
+	out := make([]byte, 0, len(h)+32)
+	skip := 0 // the number of <a> and <code> elements that the text is within
+
+	for len(h) > 0 {
+		if h[0] == '<' {
+			end := bytes.IndexByte(h, '>') + 1
+			if end == 0 {
+				end = len(h)
+			}
+			switch tagName(h[:end]) {
+			case "a", "code":
+				skip++
+			case "/a", "/code":
+				skip--
+			}
+			out = append(out, h[:end]...)
+			h = h[end:]
+			continue
+		}
+		end := bytes.IndexByte(h, '<')
+		if end == -1 {
+			end = len(h)
+		}
+		if skip > 0 {
+			out = append(out, h[:end]...)
+		} else {
+			out = vars.linkURLs(out, html.UnescapeString(string(h[:end])), textContinues(h[end:]))
+		}
+		h = h[end:]
+	}
+
+	return out
+
+}
+
+// linkURLs appends the plain text to out, escaped and with each of the URLs in it written as a link. If cut is true, the
+// text continues past a tag after its end, so a URL running to the end of the text is not linked.
+func (vars *renderVars) linkURLs(out []byte, text string, cut bool) []byte {
+	for {
+		start, end := findURL(text)
+		if start == -1 || !vars.opts.allowedURL(text[start:end]) || cut && end == len(text) {
+			return append(out, vars.opts.Escaping.escape(text)...)
+		}
+		out = append(out, vars.opts.Escaping.escape(text[:start])...)
+		pre, post := (&linkFormat{href: text[start:end], opts: vars.opts}).Wrap()
+		out = append(out, pre...)
+		out = append(out, vars.opts.Escaping.escape(text[start:end])...)
+		out = append(out, post...)
+		text = text[end:]
+	}
+}
+
+// textContinues says if the HTML (which follows a run of text) begins with inline tags after which there is more text
+// that is not white space. Void elements such as <br> and <img> end the text.
+func textContinues(h []byte) bool {
+	for len(h) > 0 && h[0] == '<' {
+		end := bytes.IndexByte(h, '>') + 1
+		if end == 0 {
+			return false
+		}
+		switch tagName(h[:end]) {
+		case "br", "img", "hr", "wbr":
+			return false
+		}
+		h = h[end:]
+	}
+	return len(h) > 0 && h[0] > ' '
+}
+
+// findURL gives the start and end of the first http or https URL in the text, or -1 and -1 if there is none. The URL
+// ends at white space, and punctuation at the end of it (such as a period ending a sentence) is not included.
+func findURL(text string) (int, int) {
+	for offset := 0; ; {
+		i := strings.Index(text[offset:], "http")
+		if i == -1 {
+			return -1, -1
+		}
+		start := offset + i
+		offset = start + len("http")
+		var scheme int
+		switch rest := text[start:]; {
+		case strings.HasPrefix(rest, "https://"):
+			scheme = len("https://")
+		case strings.HasPrefix(rest, "http://"):
+			scheme = len("http://")
+		default:
+			continue
+		}
+		if start > 0 && urlChar(text[start-1]) {
+			continue // The scheme is part of a word.
+		}
+		end := start + scheme
+		for end < len(text) && text[end] > ' ' && strings.IndexByte(`<>"`, text[end]) == -1 {
+			end++
+		}
+		end = trimURL(text[start:end]) + start
+		if end-start > scheme {
+			return start, end
+		}
+	}
+}
+
+// trimURL gives the length of the URL without the punctuation at its end. A closing parenthesis that is part of the
+// URL, as in https://en.wikipedia.org/wiki/Go_(programming_language), is kept.
+func trimURL(url string) int {
+	end := len(url)
+	for end > 0 {
+		c := url[end-1]
+		if strings.IndexByte(".,;:!?'*", c) == -1 &&
+			(c != ')' || strings.Count(url[:end], "(") >= strings.Count(url[:end], ")")) {
+			break
+		}
+		end--
+	}
+	return end
+}
+
+// urlChar says if the byte is a letter or digit, which cannot come right before a URL that is linked.
+func urlChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// tagName gives the name of the element of an HTML tag, such as "a" for <a href="..."> or "/a" for </a>.
+func tagName(tag []byte) string {
+	name := bytes.TrimPrefix(tag, []byte("<"))
+	closing := bytes.HasPrefix(name, []byte("/"))
+	if closing {
+		name = name[1:]
+	}
+	if end := bytes.IndexAny(name, " \t\n/>"); end != -1 {
+		name = name[:end]
+	}
+	if closing {
+		return "/" + string(name)
+	}
+	return string(name)
+}
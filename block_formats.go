@@ -1,11 +1,20 @@
 package quill
 
+import (
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
 // paragraph
-type textFormat struct{}
+type textFormat struct {
+	tag string
+}
 
-func (*textFormat) Fmt() *Format {
+func (tf *textFormat) Fmt() *Format {
 	return &Format{
-		Val:   "p",
+		Val:   tf.tag,
 		Place: Tag,
 		Block: true,
 	}
@@ -16,7 +25,9 @@ func (*textFormat) HasFormat(o *Op) bool {
 }
 
 // block quote
-type blockQuoteFormat struct{}
+type blockQuoteFormat struct {
+	cite string // the source of the quotation given by the "cite" attribute (if any)
+}
 
 func (*blockQuoteFormat) Fmt() *Format {
 	return &Format{
@@ -30,6 +41,131 @@ func (*blockQuoteFormat) HasFormat(o *Op) bool {
 	return o.HasAttr("blockquote")
 }
 
+// citeAttr gives the cite attribute of the block quote element, preceded by a space, or an empty string if there is no
+// citation.
+func (bf *blockQuoteFormat) citeAttr() string {
+	if bf.cite == "" {
+		return ""
+	}
+	return " cite=" + quoteAttr(bf.cite)
+}
+
+// block quote wrapped in a figure along with its attribution
+type quoteFigureFormat struct {
+	blockQuoteFormat
+	cited bool // whether the attribution has been written in the figure
+}
+
+// quoteFigureFormat implements the FormatWrapper interface.
+func (*quoteFigureFormat) Wrap() (string, string) {
+	return "<figure>", "</figure>"
+}
+
+// quoteFigureFormat implements the FormatWrapper interface.
+func (*quoteFigureFormat) Open(open []*Format, _ *Op) bool {
+	// If there is a figure already open, no need to open another.
+	for i := range open {
+		if _, ok := open[i].fm.(*quoteFigureFormat); ok {
+			return false
+		}
+	}
+	return true
+}
+
+// quoteFigureFormat implements the FormatWrapper interface.
+func (qf *quoteFigureFormat) Close(_ []*Format, o *Op, doingBlock bool) bool {
+	if !doingBlock {
+		return false
+	}
+	if o.HasAttr("attribution") {
+		// Only a single attribution line goes into a figure.
+		if qf.cited {
+			return true
+		}
+		qf.cited = true
+		return false
+	}
+	// A block quote following the attribution starts a new figure.
+	return !o.HasAttr("blockquote") || qf.cited
+}
+
+// attribution line of a block quote
+type attributionFormat struct{}
+
+func (*attributionFormat) Fmt() *Format {
+	return &Format{
+		Val:   "cite",
+		Place: Tag,
+		Block: true,
+	}
+}
+
+func (*attributionFormat) HasFormat(o *Op) bool {
+	return o.HasAttr("attribution")
+}
+
+// collapsible section (a details element with the summary line first)
+type detailsFormat struct {
+	summary bool // whether this line is the summary of the section
+}
+
+func (df *detailsFormat) Fmt() *Format {
+	if df.summary {
+		return &Format{
+			Val:   "summary",
+			Place: Tag,
+			Block: true,
+		}
+	}
+	return &Format{
+		Place: Class, // The body lines keep their own tags and only get wrapped.
+		Block: true,
+	}
+}
+
+func (*detailsFormat) HasFormat(o *Op) bool {
+	return false // Only a wrapper.
+}
+
+// detailsFormat implements the FormatWrapper interface.
+func (*detailsFormat) Wrap() (string, string) {
+	return "<details>", "</details>"
+}
+
+// detailsFormat implements the FormatWrapper interface.
+func (*detailsFormat) Open(open []*Format, _ *Op) bool {
+	// If there is a section already open, no need to open another.
+	for i := range open {
+		if _, ok := open[i].fm.(*detailsFormat); ok {
+			return false
+		}
+	}
+	return true
+}
+
+// detailsFormat implements the FormatWrapper interface.
+func (*detailsFormat) Close(_ []*Format, o *Op, doingBlock bool) bool {
+	// A summary line starts a new section.
+	return doingBlock && (!o.HasAttr("details") || o.Attrs["details"] == "summary")
+}
+
+// footnote definition (collected and written in a list at the end of the document)
+type footnoteFormat struct {
+	id string
+}
+
+func (*footnoteFormat) Fmt() *Format {
+	return &Format{
+		Val:   "li",
+		Place: Tag,
+		Block: true,
+	}
+}
+
+func (ff *footnoteFormat) HasFormat(o *Op) bool {
+	return o.Attrs["footnote"] == ff.id
+}
+
 // header
 type headerFormat struct {
 	level string // the string "1", "2", "3", ...
@@ -47,10 +183,37 @@ func (hf *headerFormat) HasFormat(o *Op) bool {
 	return o.Attrs["header"] == hf.level
 }
 
+// isHeader says if the tag name is that of a header (h1 through h6).
+func isHeader(tagName string) bool {
+	return len(tagName) == 2 && tagName[0] == 'h' && tagName[1] >= '1' && tagName[1] <= '6'
+}
+
+// slugify turns the text of a header into an ID made up of lowercase letters, digits, and hyphens.
+func slugify(text string) string {
+	var slug strings.Builder
+	hyphen := false
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if hyphen && slug.Len() > 0 {
+				slug.WriteByte('-')
+			}
+			hyphen = false
+			slug.WriteRune(r)
+		case unicode.IsSpace(r) || r == '-' || r == '_':
+			hyphen = true
+		}
+	}
+	return slug.String()
+}
+
 // list
 type listFormat struct {
 	lType  string // either "ul" or "ol"
-	indent uint8  // the number of nested
+	check  string // for a checklist, either "true" or "false" (whether the items are checked)
+	indent int    // the number of nested
+	label  string // the accessible label of the list (if any)
+	start  int    // the number of the first item of an ordered list (0 if it is not given)
 }
 
 func (lf *listFormat) Fmt() *Format {
@@ -62,19 +225,81 @@ func (lf *listFormat) Fmt() *Format {
 }
 
 func (lf *listFormat) HasFormat(o *Op) bool {
-	return o.HasAttr("list")
+	return listItem(o)
+}
+
+// listItem says if the Op ends a list item. A line with the list type "none" (such as a line that is only indented) is
+// not in a list.
+func listItem(o *Op) bool {
+	return o.HasAttr("list") && o.Attrs["list"] != "none"
+}
+
+// listTag gives the tag name of the list for a list item.
+func listTag(o *Op) string {
+	switch o.Attrs["list"] {
+	case "bullet", "checked", "unchecked":
+		return "ul"
+	}
+	return "ol"
+}
+
+// listCheck gives the data-checked value of the list for a checklist item or "" for an item of any other list.
+func listCheck(o *Op) string {
+	switch o.Attrs["list"] {
+	case "checked":
+		return "true"
+	case "unchecked":
+		return "false"
+	}
+	return ""
+}
+
+// nests says if the lists of the items indented under an item are written within the item, which is how checklists are
+// written. The items of other lists are written at the same level with an indent class, as Quill writes them.
+func (lf *listFormat) nests() bool {
+	return lf.check != ""
+}
+
+// listStart gives the number of the first item of an ordered list given by the "start" attribute, or 0 if it is not set
+// to a positive number.
+func listStart(o *Op) int {
+	start, err := strconv.Atoi(o.Attrs["start"])
+	if err != nil || start < 1 {
+		return 0
+	}
+	return start
+}
+
+// continues says if the list item belongs in the same list as the items of lf.
+func (lf *listFormat) continues(o *Op) bool {
+	return listItem(o) && listTag(o) == lf.lType && listCheck(o) == lf.check
 }
 
 // listFormat implements the FormatWrapper interface.
 func (lf *listFormat) Wrap() (string, string) {
-	return "<" + lf.lType + ">", "</" + lf.lType + ">"
+	attrs := ""
+	if lf.check != "" {
+		attrs += ` data-checked="` + lf.check + `"`
+	}
+	if lf.label != "" {
+		attrs += " aria-label=" + quoteAttr(lf.label)
+	}
+	if lf.start > 0 && lf.lType == "ol" {
+		attrs += ` start="` + strconv.Itoa(lf.start) + `"`
+	}
+	if lf.nests() {
+		// The last item is left open for any items nested within it (see writeBlock).
+		return "<" + lf.lType + attrs + ">", "</li></" + lf.lType + ">"
+	}
+	return "<" + lf.lType + attrs + ">", "</" + lf.lType + ">"
 }
 
 // listFormat implements the FormatWrapper interface.
 func (lf *listFormat) Open(open []*Format, o *Op) bool {
-	// If there is a list of this type already open, no need to open another.
+	// If there is a list of this type already open (at the same level, for a nesting list), no need to open another.
 	for i := range open {
-		if open[i].Place == Tag && open[i].Val == "<"+lf.lType+">" {
+		if olf, ok := open[i].fm.(*listFormat); ok && olf.lType == lf.lType && olf.check == lf.check &&
+			(!lf.nests() || olf.indent == lf.indent) {
 			return false
 		}
 	}
@@ -88,9 +313,15 @@ func (lf *listFormat) Close(open []*Format, o *Op, doingBlock bool) bool {
 		return false
 	}
 
-	t := o.Attrs["list"] // The type of the current list item (ordered or bullet).
+	if lf.nests() {
+		// A checklist item indented further is nested within the open item.
+		if listCheck(o) != "" && indentLevel(o) > lf.indent {
+			return false
+		}
+		return !lf.continues(o) || indentLevel(o) != lf.indent
+	}
 
-	return !o.HasAttr("list") || (t == "ordered" && lf.lType != "ol") || (t == "bullet" && lf.lType != "ul")
+	return !lf.continues(o)
 
 	// Currently, the way Quill.js renders nested lists isn't very satisfactory. But we'll stay consistent with how
 	// it appears to users for now. The code below is mostly correct for a better way to render nested lists.
@@ -99,8 +330,8 @@ func (lf *listFormat) Close(open []*Format, o *Op, doingBlock bool) bool {
 	//	return true
 	//}
 
-	//t := o.Attrs["list"]                   // The type of the current list item (ordered or bullet).
-	// ind := indentDepths[o.Attrs["indent"]] // The indent of the current list item.
+	//t := o.Attrs["list"]  // The type of the current list item (ordered or bullet).
+	// ind := indentLevel(o) // The indent of the current list item.
 
 	// Close the list block only if both (a) the current list item is staying at the same indent level or is at a
 	// lower indent level and (b) the type of the list is different from the type of the previous.
@@ -108,23 +339,32 @@ func (lf *listFormat) Close(open []*Format, o *Op, doingBlock bool) bool {
 
 }
 
-// indentDepths gives either the indent amount of a list or 0 if there is no indenting.
-var indentDepths = map[string]uint8{
-	"1": 1,
-	"2": 2,
-	"3": 3,
-	"4": 4,
-	"5": 5,
+// indentLevel gives the indent level set by the "indent" attribute, or 0 if it is not set to a positive number.
+func indentLevel(o *Op) int {
+	level, err := strconv.Atoi(o.Attrs["indent"])
+	if err != nil || level < 1 {
+		return 0
+	}
+	return level
 }
 
 // text alignment
 type alignFormat struct {
-	val string
+	val    string
+	prefix string // the class name prefix
+	style  bool   // whether to write a text-align style instead of a class
 }
 
 func (af *alignFormat) Fmt() *Format {
+	if af.style {
+		return &Format{
+			Val:   "text-align:" + af.val + ";",
+			Place: Style,
+			Block: true,
+		}
+	}
 	return &Format{
-		Val:   "align-" + af.val,
+		Val:   af.prefix + "align-" + af.val,
 		Place: Class,
 		Block: true,
 	}
@@ -134,25 +374,88 @@ func (af *alignFormat) HasFormat(o *Op) bool {
 	return o.Attrs["align"] == af.val
 }
 
+// text direction
+type directionFormat struct {
+	dir    string
+	prefix string // the class name prefix
+}
+
+func (df *directionFormat) Fmt() *Format {
+	return &Format{
+		Val:   df.prefix + "direction-" + df.dir,
+		Place: Class,
+		Block: true,
+	}
+}
+
+func (df *directionFormat) HasFormat(o *Op) bool {
+	return o.Attrs["direction"] == df.dir
+}
+
 type indentFormat struct {
-	in string
+	level  int
+	style  string // the padding style to write instead of a class (if set)
+	nested bool   // whether the line is a checklist item, which is nested within the item it is indented under instead
+	prefix string // the class name prefix
 }
 
 func (inf *indentFormat) Fmt() *Format {
+	if inf.nested {
+		return nil
+	}
+	if inf.style != "" {
+		return &Format{
+			Val:   inf.style,
+			Place: Style,
+			Block: true,
+		}
+	}
 	return &Format{
-		Val:   "indent-" + inf.in,
+		Val:   inf.prefix + "indent-" + strconv.Itoa(inf.level),
 		Place: Class,
 		Block: true,
 	}
 }
 
 func (inf *indentFormat) HasFormat(o *Op) bool {
-	return o.Attrs["indent"] == inf.in
+	return indentLevel(o) == inf.level
+}
+
+// style set on a whole block
+type styleFormat struct {
+	style string // the sanitized style
+}
+
+func (sf *styleFormat) Fmt() *Format {
+	return &Format{
+		Val:   sf.style,
+		Place: Style,
+		Block: true,
+	}
+}
+
+func (sf *styleFormat) HasFormat(o *Op) bool {
+	return sanitizeStyle(o.Attrs["style"]) == sf.style
 }
 
 // code block
 type codeBlockFormat struct {
-	o *Op
+	lang string // the language of the code (empty if it is not given)
+	opts *RenderOptions
+}
+
+// codeLanguage gives the language set as the value of the "code-block" attribute, if the value is not simply true.
+func codeLanguage(o *Op) string {
+	if lang := o.Attrs["code-block"]; lang != "y" && lang != "true" {
+		return lang
+	}
+	return ""
+}
+
+// codeIndent gives the leading spaces (four for each level) written for the indent of a line of a code block. A class
+// cannot be set on a single line within a <pre> element.
+func codeIndent(o *Op) string {
+	return strings.Repeat("    ", indentLevel(o))
 }
 
 func (cf *codeBlockFormat) Fmt() *Format {
@@ -167,15 +470,25 @@ func (cf *codeBlockFormat) HasFormat(o *Op) bool {
 }
 
 // codeBlockFormat implements the FormatWrapper interface.
-func (*codeBlockFormat) Wrap() (string, string) {
-	return "<pre>", "\n</pre>"
+func (cf *codeBlockFormat) Wrap() (string, string) {
+	pre := `<pre class="` + cf.opts.classPrefix() + `syntax">`
+	if cf.lang == "" {
+		return pre, "\n</pre>"
+	}
+	// The language is given as a class of a <code> element for syntax highlighters. Any white space in it is replaced
+	// with hyphens so that it stays a single class name.
+	pre += `<code class="language-` + cf.opts.Escaping.escape(strings.Join(strings.Fields(cf.lang), "-")) + `">`
+	if cf.opts.CodeLanguageLabel {
+		pre = `<div class="code-lang">` + cf.opts.Escaping.escape(cf.lang) + "</div>" + pre
+	}
+	return pre, "\n</code></pre>"
 }
 
 // codeBlockFormat implements the FormatWrapper interface.
 func (*codeBlockFormat) Open(open []*Format, _ *Op) bool {
 	// If there is a code block already open, no need to open another.
 	for i := range open {
-		if open[i].Place == Tag && open[i].Val == "<pre>" {
+		if _, ok := open[i].fm.(*codeBlockFormat); ok {
 			return false
 		}
 	}
@@ -183,14 +496,65 @@ func (*codeBlockFormat) Open(open []*Format, _ *Op) bool {
 }
 
 // codeBlockFormat implements the FormatWrapper interface.
+// The line feeds between the lines of a code block are written by writeBlock.
 func (cf *codeBlockFormat) Close(_ []*Format, o *Op, doingBlock bool) bool {
-	if doingBlock && !o.HasAttr("code-block") {
-		return true
+	// A line in another language starts a new code block.
+	return doingBlock && (!o.HasAttr("code-block") || codeLanguage(o) != cf.lang)
+}
+
+// divider (a horizontal rule)
+type dividerFormat struct {
+	opts *RenderOptions
+}
+
+func (*dividerFormat) Fmt() *Format {
+	return &Format{Block: true} // The body contains the entire element.
+}
+
+func (*dividerFormat) HasFormat(o *Op) bool {
+	return o.Type == "divider"
+}
+
+// dividerFormat implements the FormatWriter interface.
+func (df *dividerFormat) Write(buf io.Writer) {
+	io.WriteString(buf, "<hr"+df.opts.voidEnd("hr"))
+}
+
+// section break
+type sectionBreakFormat struct {
+	opts *RenderOptions
+}
+
+func (*sectionBreakFormat) Fmt() *Format {
+	return &Format{Block: true} // The body contains the entire element.
+}
+
+func (*sectionBreakFormat) HasFormat(o *Op) bool {
+	return o.Type == "section-break"
+}
+
+// sectionBreakFormat implements the FormatWriter interface.
+func (sf *sectionBreakFormat) Write(buf io.Writer) {
+	if sf.opts.SectionBreak != "" {
+		io.WriteString(buf, sf.opts.SectionBreak)
+		return
 	}
-	// We are simply adding another line to the code block. The previous line should end with
-	// a "\n" though all instances of "\n" are stripped out by the split from the start.
-	if !doingBlock {
-		o.Data = "\n" + o.Data
+	io.WriteString(buf, `<div class="section-break">* * *</div>`)
+}
+
+// unknown block attributes written as data-* attributes (see RenderOptions.PreserveUnknownAttrs)
+type dataAttrsFormat struct {
+	names []string // the names of the attributes, sorted
+	attrs string   // the data-* attributes, each preceded by a space
+}
+
+func (*dataAttrsFormat) Fmt() *Format {
+	return &Format{
+		Place: Class, // The attributes are added to the block element by writeBlock.
+		Block: true,
 	}
-	return false
+}
+
+func (df *dataAttrsFormat) HasFormat(o *Op) bool {
+	return dataAttrs(o, df.names) == df.attrs
 }
@@ -0,0 +1,17 @@
+// Package bluemonday adapts a bluemonday policy for use as the Sanitizer in quill.RenderOptions.
+//
+// The adapter is kept in its own module so that the quill package itself does not depend on bluemonday.
+package bluemonday
+
+import (
+	bm "github.com/microcosm-cc/bluemonday"
+)
+
+// Sanitizer returns a function that sanitizes HTML with the given policy. If policy is nil, the bluemonday UGCPolicy
+// is used. The returned function can be given to quill.RenderOptions.WithSanitizer.
+func Sanitizer(policy *bm.Policy) func(html []byte) []byte {
+	if policy == nil {
+		policy = bm.UGCPolicy()
+	}
+	return policy.SanitizeBytes
+}
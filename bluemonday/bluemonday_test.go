@@ -0,0 +1,26 @@
+package bluemonday
+
+import (
+	"testing"
+
+	bm "github.com/microcosm-cc/bluemonday"
+)
+
+func TestSanitizer(t *testing.T) {
+
+	cases := []struct {
+		policy   *bm.Policy
+		in, want string
+	}{
+		{nil, `<p>text <a href="javascript:alert(1)">link</a></p>`, `<p>text link</p>`},
+		{nil, `<p><strong>bold</strong><script>alert(1)</script></p>`, `<p><strong>bold</strong></p>`},
+		{bm.StrictPolicy(), `<p><strong>bold</strong></p>`, `bold`},
+	}
+
+	for i, tc := range cases {
+		if got := Sanitizer(tc.policy)([]byte(tc.in)); string(got) != tc.want {
+			t.Errorf("(index %d) wanted %s; got: %s", i, tc.want, got)
+		}
+	}
+
+}
@@ -3,7 +3,7 @@ package quill
 import (
 	"bytes"
 	"sort"
-	"strconv"
+	"strings"
 )
 
 // A formatState holds the current state of open tag, class, or style formats.
@@ -12,7 +12,27 @@ type formatState []*Format // the list of currently open attribute tags
 // hasSet says if the given format is already opened.
 func (fs *formatState) hasSet(fm *Format) bool {
 	for i := range *fs {
-		if (*fs)[i].Place == fm.Place && (*fs)[i].Val == fm.Val {
+		if (*fs)[i].Place == fm.Place && (*fs)[i].Val == fm.Val && (fm.Place != Class || (*fs)[i].className() == fm.className()) {
+			return true
+		}
+	}
+	return false
+}
+
+// openList gives the list that is currently open, or nil if there is none.
+func (fs *formatState) openList() *listFormat {
+	for i := len(*fs) - 1; i >= 0; i-- {
+		if lf, ok := (*fs)[i].fm.(*listFormat); ok && (*fs)[i].wrap {
+			return lf
+		}
+	}
+	return nil
+}
+
+// quoteFigureOpen says if the figure of a block quote is open for its attribution (see RenderOptions.QuoteAttribution).
+func (fs *formatState) quoteFigureOpen() bool {
+	for i := range *fs {
+		if _, ok := (*fs)[i].fm.(*quoteFigureFormat); ok {
 			return true
 		}
 	}
@@ -32,16 +52,21 @@ func (fs *formatState) closePrevious(buf *bytes.Buffer, o *Op, doingBlock bool)
 		// If this format is not set on the current Op, close it.
 		if (!f.wrap && !f.fm.HasFormat(o)) || (f.wrap && f.fm.(FormatWrapper).Close(*fs, o, doingBlock)) {
 
+			// A style written in the same span as the styles before it can be closed only along with them, so the
+			// styles of the span that are still set are re-opened.
+			closing := i
+			for i > 0 && (*fs)[i].merged {
+				i--
+			}
+
 			// If we need to close a tag after which there are tags that should stay open, close the following tags for now.
-			if i < len(*fs)-1 {
-				for ij := len(*fs) - 1; ij > i; ij-- {
+			for ij := len(*fs) - 1; ij >= i; ij-- {
+				if ij > closing || (ij < closing && (*fs)[ij].fm.HasFormat(o)) {
 					closedTemp.add((*fs)[ij])
-					fs.pop(buf)
 				}
+				fs.pop(buf)
 			}
 
-			fs.pop(buf)
-
 		}
 
 	}
@@ -55,7 +80,9 @@ func (fs *formatState) closePrevious(buf *bytes.Buffer, o *Op, doingBlock bool)
 // pop removes the last format from the state of currently open formats.
 func (fs *formatState) pop(buf *bytes.Buffer) {
 	indx := len(*fs) - 1
-	if (*fs)[indx].wrap {
+	if (*fs)[indx].merged {
+		// The span is closed with the first style written in it.
+	} else if (*fs)[indx].wrap {
 		buf.WriteString((*fs)[indx].wrapPost)
 	} else if (*fs)[indx].Place == Tag {
 		closeTag(buf, (*fs)[indx].Val)
@@ -74,30 +101,66 @@ func (fs *formatState) add(f *Format) {
 	}
 }
 
+// limitDepth drops formats from fs, which holds inline formats about to be opened, so that no more than max inline
+// formats are open at once along with those already open. The formats that come first in the sorting order are kept.
+func (fs *formatState) limitDepth(open formatState, max int) {
+	for _, f := range open {
+		if !f.Block {
+			max--
+		}
+	}
+	if max < 0 {
+		max = 0
+	}
+	if len(*fs) > max {
+		sort.Sort(fs)
+		*fs = (*fs)[:max]
+	}
+}
+
 // writeFormats sorts the formats in the current formatState and writes them all out to buf. If a format implements
 // the FormatWrapper interface, that format's opening wrap is printed.
 func (fs *formatState) writeFormats(buf *bytes.Buffer) {
 
 	sort.Sort(fs) // Ensure that the serialization is consistent even if attribute ordering in a map changes.
 
-	for _, f := range *fs {
+	for i, f := range *fs {
+
+		f.merged = false
 
 		if f.wrap {
 			buf.WriteString(f.Val) // The complete opening or closing wrap is given.
 			continue
 		}
 
+		// Styles following each other are written in a single span.
+		if f.Place == Style && i > 0 && (*fs)[i-1].Place == Style && !(*fs)[i-1].wrap {
+			f.merged = true
+			continue
+		}
+
 		buf.WriteByte('<')
 
 		switch f.Place {
 		case Tag:
 			buf.WriteString(f.Val)
+			buf.WriteString(classesList(f.Classes))
 		case Class:
 			buf.WriteString("span class=")
-			buf.WriteString(strconv.Quote(f.Val))
+			buf.WriteString(quoteAttr(f.className()))
 		case Style:
+			style := f.Val
+			for _, next := range (*fs)[i+1:] {
+				if next.Place != Style || next.wrap {
+					break
+				}
+				if !strings.HasSuffix(style, ";") {
+					style += ";"
+				}
+				style += next.Val
+			}
 			buf.WriteString("span style=")
-			buf.WriteString(strconv.Quote(f.Val))
+			buf.WriteString(quoteAttr(style))
 		}
 
 		buf.WriteByte('>')
@@ -115,10 +178,10 @@ func (fs *formatState) Less(i, j int) bool {
 	fsi, fsj := (*fs)[i], (*fs)[j]
 
 	// Formats that implement the FormatWrapper interface are written first.
-	if _, ok := fsi.fm.(FormatWrapper); ok {
-		return true
-	} else if _, ok := fsj.fm.(FormatWrapper); ok {
-		return false
+	_, wi := fsi.fm.(FormatWrapper)
+	_, wj := fsj.fm.(FormatWrapper)
+	if wi != wj {
+		return wi
 	}
 
 	// Tags are written first, then classes, and then style attributes.
@@ -126,6 +189,17 @@ func (fs *formatState) Less(i, j int) bool {
 		return fsi.Place < fsj.Place
 	}
 
+	// Styles (which may be merged into a single style attribute) are ordered by the name of the CSS property.
+	if fsi.Place == Style && !wi {
+		if pi, pj := styleProperty(fsi.Val), styleProperty(fsj.Val); pi != pj {
+			return pi < pj
+		}
+	}
+
+	if fsi.Place == Class {
+		return fsi.className() < fsj.className()
+	}
+
 	// Simply check values.
 	return fsi.Val < fsj.Val
 
@@ -134,3 +208,21 @@ func (fs *formatState) Less(i, j int) bool {
 func (fs *formatState) Swap(i, j int) {
 	(*fs)[i], (*fs)[j] = (*fs)[j], (*fs)[i]
 }
+
+// styleProperty gives the name of the (first) CSS property set by a style.
+func styleProperty(style string) string {
+	if colon := strings.IndexByte(style, ':'); colon != -1 {
+		return strings.TrimSpace(style[:colon])
+	}
+	return style
+}
+
+// sortStyles sorts styles by the name of the CSS property that each sets.
+func sortStyles(styles []string) {
+	sort.Slice(styles, func(i, j int) bool {
+		if pi, pj := styleProperty(styles[i]), styleProperty(styles[j]); pi != pj {
+			return pi < pj
+		}
+		return styles[i] < styles[j]
+	})
+}
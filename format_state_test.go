@@ -99,12 +99,12 @@ func TestFormatState_closePrevious(t *testing.T) {
 
 	cases := []formatState{
 		{
-			{"em", Tag, false, false, "", "", o1.getFormatter("italic", nil)},
-			{"strong", Tag, false, false, "", "", o1.getFormatter("bold", nil)},
+			{"em", Tag, false, nil, false, false, "", "", o1.getFormatter("italic", nil)},
+			{"strong", Tag, false, nil, false, false, "", "", o1.getFormatter("bold", nil)},
 		},
 		{
-			{"background-color:#e0e0e0;", Style, false, false, "", "", o2.getFormatter("background", nil)},
-			{"em", Tag, false, false, "", "", o2.getFormatter("italic", nil)},
+			{"background-color:#e0e0e0;", Style, false, nil, false, false, "", "", o2.getFormatter("background", nil)},
+			{"em", Tag, false, nil, false, false, "", "", o2.getFormatter("italic", nil)},
 		},
 	}
 
@@ -128,6 +128,37 @@ func TestFormatState_closePrevious(t *testing.T) {
 
 }
 
+func TestFormatState_mergedStyles(t *testing.T) {
+
+	o := blankOp()
+	o.Attrs["color"] = "red"
+	o.Attrs["background"] = "#e0e0e0"
+	o.Attrs["italic"] = "y"
+
+	var fs formatState
+	for _, attr := range []string{"color", "italic", "background"} {
+		fmTer := o.getFormatter(attr, nil)
+		f := fmTer.Fmt()
+		f.fm = fmTer
+		fs.add(f)
+	}
+
+	var buf bytes.Buffer
+	fs.writeFormats(&buf)
+	if want := `<em><span style="background-color:#e0e0e0;color:red;">`; buf.String() != want {
+		t.Errorf("opened formats wrong; wanted %q; got %q", want, buf.String())
+	}
+	buf.Reset()
+
+	// Only the color is unset, so the span is closed and re-opened with the background color.
+	delete(o.Attrs, "color")
+	fs.closePrevious(&buf, o, false)
+	if want := `</span><span style="background-color:#e0e0e0;">`; buf.String() != want || len(fs) != 2 {
+		t.Errorf("closed formats wrong; wanted %q; got %q", want, buf.String())
+	}
+
+}
+
 func TestFormatState_Sort(t *testing.T) {
 
 	o := &Op{
@@ -158,6 +189,11 @@ func TestFormatState_Sort(t *testing.T) {
 			{"em", Tag, "italic"},
 			{`<a href="https://widerwebs.com" target="_blank">`, Tag, "link"}, // link wrapper
 		},
+		{
+			{"font-size:18px;", Style, "size"},
+			{"font:italic;", Style, "color"},
+			{"color:red;", Style, "color"},
+		},
 	}
 
 	want := [][]struct {
@@ -182,6 +218,11 @@ func TestFormatState_Sort(t *testing.T) {
 			{`<a href="https://widerwebs.com" target="_blank">`, Tag, "link"}, // link wrapper
 			{"em", Tag, "italic"},
 		},
+		{
+			{"color:red;", Style, "color"},
+			{"font:italic;", Style, "color"},
+			{"font-size:18px;", Style, "size"},
+		},
 	}
 
 	for i := range cases {
@@ -224,3 +265,35 @@ func TestFormatState_Sort(t *testing.T) {
 	}
 
 }
+
+func TestFormatState_limitDepth(t *testing.T) {
+
+	o := blankOp()
+	o.Attrs["color"] = "red"
+
+	newState := func(keywords ...string) formatState {
+		fs := make(formatState, 0, len(keywords))
+		for _, k := range keywords {
+			fmTer := o.getFormatter(k, nil)
+			fm := fmTer.Fmt()
+			fm.fm = fmTer
+			fs = append(fs, fm)
+		}
+		return fs
+	}
+
+	open := newState("bold", "italic")
+
+	adding := newState("underline", "strike", "color")
+	adding.limitDepth(open, 4)
+	if len(adding) != 2 || adding[0].Val != "s" || adding[1].Val != "u" {
+		t.Errorf("kept wrong formats: %+v, %+v", adding[0], adding[1])
+	}
+
+	adding = newState("underline")
+	adding.limitDepth(open, 2)
+	if len(adding) != 0 {
+		t.Errorf("kept %d formats beyond the limit", len(adding))
+	}
+
+}
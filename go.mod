@@ -1,3 +1,5 @@
 module github.com/dchenk/go-render-quill
 
-go 1.13
+go 1.18
+
+require golang.org/x/net v0.26.0
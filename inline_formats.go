@@ -2,7 +2,9 @@ package quill
 
 import (
 	"io"
+	"sort"
 	"strconv"
+	"strings"
 )
 
 // bold
@@ -34,11 +36,13 @@ func (*italicFormat) HasFormat(o *Op) bool {
 }
 
 // underline
-type underlineFormat struct{}
+type underlineFormat struct {
+	tag string // either "u" or "ins"
+}
 
-func (*underlineFormat) Fmt() *Format {
+func (uf *underlineFormat) Fmt() *Format {
 	return &Format{
-		Val:   "u",
+		Val:   uf.tag,
 		Place: Tag,
 	}
 }
@@ -49,13 +53,15 @@ func (*underlineFormat) HasFormat(o *Op) bool {
 
 // text color
 type colorFormat struct {
-	c string
+	c     string
+	block bool // whether the color is set on a line break, coloring the whole block
 }
 
 func (cf *colorFormat) Fmt() *Format {
 	return &Format{
 		Val:   "color:" + cf.c + ";",
 		Place: Style,
+		Block: cf.block,
 	}
 }
 
@@ -66,6 +72,7 @@ func (cf *colorFormat) HasFormat(o *Op) bool {
 // link
 type linkFormat struct {
 	href string
+	opts *RenderOptions
 }
 
 func (*linkFormat) Fmt() *Format { return new(Format) } // Only a wrapper.
@@ -75,11 +82,24 @@ func (lf *linkFormat) HasFormat(*Op) bool {
 }
 
 func (lf *linkFormat) Wrap() (string, string) {
-	return `<a href=` + strconv.Quote(lf.href) + ` target="_blank">`, "</a>"
+	if lf.opts.SiteOrigin != "" && !lf.opts.crossOrigin(lf.href) {
+		return `<a href=` + quoteAttr(lf.href) + `>`, "</a>"
+	}
+	target := lf.opts.linkTarget()
+	if lf.opts.SiteOrigin != "" && target == "_blank" {
+		return `<a href=` + quoteAttr(lf.href) + ` target="_blank" rel="noopener">`, "</a>"
+	}
+	return `<a href=` + quoteAttr(lf.href) + ` target=` + quoteAttr(target) + `>`, "</a>"
 }
 
-func (lf *linkFormat) Open(_ []*Format, _ *Op) bool {
-	return true // This format will only appear when there is a "link" attribute set.
+func (lf *linkFormat) Open(open []*Format, _ *Op) bool {
+	// A link continued by the op is left open rather than nested within itself.
+	for _, f := range open {
+		if l, ok := f.fm.(*linkFormat); ok && f.wrap && l.href == lf.href {
+			return false
+		}
+	}
+	return true
 }
 
 func (lf *linkFormat) Close(_ []*Format, o *Op, _ bool) bool {
@@ -88,10 +108,57 @@ func (lf *linkFormat) Close(_ []*Format, o *Op, _ bool) bool {
 
 // image
 type imageFormat struct {
-	src, alt string
+	src, alt    string
+	style       string        // the sanitized style
+	placeholder string        // a placeholder (such as a tiny preview) to show while the image loads
+	sources     []imageSource // alternate sources to write in a <picture> element
+	width       int           // the width in pixels (0 if it is not given)
+	height      int           // the height in pixels (0 if it is not given)
+	caption     string        // a caption to write with the image in a <figure> element (if any)
+	standalone  ImageBlock    // how the image is written when it is alone on its line
+	opts        *RenderOptions
+}
+
+// imageDimension reads a width or height attribute in pixels, such as "300" or "300px", and gives 0 if it is not valid.
+func imageDimension(attr string) int {
+	n, err := strconv.Atoi(strings.TrimSuffix(attr, "px"))
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
 }
 
-func (*imageFormat) Fmt() *Format { return nil } // The body contains the entire element.
+// An imageSource is an alternate version of an image given by an attribute like "source-webp" on an image op.
+type imageSource struct {
+	srcset, mimeType string
+}
+
+// imageSources lists the alternate sources set on an image op, sorted by MIME type.
+func imageSources(o *Op) []imageSource {
+	var sources []imageSource
+	for attr, val := range o.Attrs {
+		if strings.HasPrefix(attr, "source-") && len(attr) > 7 && val != "" {
+			sources = append(sources, imageSource{srcset: val, mimeType: "image/" + attr[7:]})
+		}
+	}
+	sort.Slice(sources, func(i, j int) bool {
+		return sources[i].mimeType < sources[j].mimeType
+	})
+	return sources
+}
+
+func (imf *imageFormat) Fmt() *Format {
+	if imf.caption != "" {
+		return &Format{Block: true} // A figure is a block embed.
+	}
+	switch imf.standalone {
+	case ImageBare:
+		return &Format{Block: true}
+	case ImageFigure:
+		return &Format{Val: "figure", Place: Tag, Block: true}
+	}
+	return nil // The body contains the entire element.
+}
 
 func (imf *imageFormat) HasFormat(o *Op) bool {
 	return o.Type == "image" && o.Data == imf.src
@@ -99,21 +166,174 @@ func (imf *imageFormat) HasFormat(o *Op) bool {
 
 // imageFormat implements the FormatWriter interface.
 func (imf *imageFormat) Write(buf io.Writer) {
+	if imf.caption != "" {
+		io.WriteString(buf, "<figure>")
+	}
+	if len(imf.sources) > 0 {
+		io.WriteString(buf, "<picture>")
+		for _, s := range imf.sources {
+			io.WriteString(buf, "<source srcset=")
+			io.WriteString(buf, quoteAttr(s.srcset))
+			io.WriteString(buf, " type=")
+			io.WriteString(buf, quoteAttr(s.mimeType))
+			io.WriteString(buf, imf.opts.voidEnd("source"))
+		}
+	}
 	io.WriteString(buf, "<img src=")
-	io.WriteString(buf, strconv.Quote(imf.src))
+	io.WriteString(buf, quoteAttr(imf.src))
 	if imf.alt != "" {
 		io.WriteString(buf, " alt=")
-		io.WriteString(buf, strconv.Quote(imf.alt))
+		io.WriteString(buf, quoteAttr(imf.alt))
+	}
+	width, height := imf.opts.imageSize(imf.width, imf.height)
+	if width > 0 {
+		io.WriteString(buf, ` width="`+strconv.Itoa(width)+`"`)
+	}
+	if height > 0 {
+		io.WriteString(buf, ` height="`+strconv.Itoa(height)+`"`)
+	}
+	if imf.style != "" {
+		io.WriteString(buf, " style=")
+		io.WriteString(buf, quoteAttr(imf.style))
+	}
+	if imf.placeholder != "" {
+		io.WriteString(buf, " data-placeholder=")
+		io.WriteString(buf, quoteAttr(imf.placeholder))
+	}
+	if imf.opts.LazyImages {
+		io.WriteString(buf, ` loading="lazy" decoding="async"`)
+	}
+	io.WriteString(buf, imf.opts.voidEnd("img"))
+	if len(imf.sources) > 0 {
+		io.WriteString(buf, "</picture>")
+	}
+	if imf.caption != "" {
+		io.WriteString(buf, "<figcaption>"+imf.opts.Escaping.escape(imf.caption)+"</figcaption></figure>")
+	}
+}
+
+// footnote reference (an embed giving the ID of the footnote)
+type footnoteRefFormat struct {
+	id   string
+	opts *RenderOptions
+}
+
+func (*footnoteRefFormat) Fmt() *Format { return nil } // The body contains the entire element.
+
+func (ff *footnoteRefFormat) HasFormat(o *Op) bool {
+	return o.Type == "footnote-ref" && o.Data == ff.id
+}
+
+// footnoteRefFormat implements the FormatWriter interface.
+func (ff *footnoteRefFormat) Write(buf io.Writer) {
+	io.WriteString(buf, `<sup class="footnote-ref"><a href=`+quoteAttr("#fn-"+ff.id)+` id=`+quoteAttr("fnref-"+ff.id)+`>`)
+	io.WriteString(buf, ff.opts.Escaping.escape(ff.id))
+	io.WriteString(buf, "</a></sup>")
+}
+
+// inline code
+type codeFormat struct{}
+
+func (*codeFormat) Fmt() *Format {
+	return &Format{
+		Val:   "code",
+		Place: Tag,
+	}
+}
+
+func (*codeFormat) HasFormat(o *Op) bool {
+	return o.HasAttr("code")
+}
+
+// mention (an embed object with the "id", "value", and "denotationChar" of what is mentioned)
+type mentionFormat struct {
+	id, value, char string
+	opts            *RenderOptions
+}
+
+func newMentionFormat(o *Op, opts *RenderOptions) *mentionFormat {
+	m, _ := o.RawData.(map[string]interface{})
+	return &mentionFormat{
+		id:    extractString(m["id"]),
+		value: extractString(m["value"]),
+		char:  extractString(m["denotationChar"]),
+		opts:  opts,
 	}
-	buf.Write([]byte{'>'})
+}
+
+func (*mentionFormat) Fmt() *Format { return nil } // The body contains the entire element.
+
+func (mf *mentionFormat) HasFormat(o *Op) bool {
+	return o.Type == "mention" && *newMentionFormat(o, mf.opts) == *mf
+}
+
+// mentionFormat implements the FormatWriter interface.
+func (mf *mentionFormat) Write(buf io.Writer) {
+	io.WriteString(buf, `<span class="mention" data-id=`+quoteAttr(mf.id)+`>`)
+	io.WriteString(buf, mf.opts.Escaping.escape(mf.char+mf.value))
+	io.WriteString(buf, "</span>")
+}
+
+// formula (an embed giving the TeX of the formula, to be rendered in the browser)
+type formulaFormat struct {
+	tex  string
+	opts *RenderOptions
+}
+
+func (*formulaFormat) Fmt() *Format { return nil } // The body contains the entire element.
+
+func (ff *formulaFormat) HasFormat(o *Op) bool {
+	return o.Type == "formula" && o.Data == ff.tex
+}
+
+// formulaFormat implements the FormatWriter interface.
+// The TeX is also written as the text of the element so that it is shown if the formula is not rendered.
+func (ff *formulaFormat) Write(buf io.Writer) {
+	io.WriteString(buf, `<span class="`+ff.opts.classPrefix()+`formula" data-value=`+quoteAttr(ff.tex)+`>`)
+	io.WriteString(buf, ff.opts.Escaping.escape(ff.tex))
+	io.WriteString(buf, "</span>")
+}
+
+// soft line break (a break within a block, such as one made with Shift+Enter)
+type breakFormat struct {
+	opts *RenderOptions
+}
+
+func (*breakFormat) Fmt() *Format { return nil } // The body contains the entire element.
+
+func (*breakFormat) HasFormat(o *Op) bool {
+	return o.Type == "break"
+}
+
+// breakFormat implements the FormatWriter interface.
+func (bf *breakFormat) Write(buf io.Writer) {
+	io.WriteString(buf, "<br"+bf.opts.voidEnd("br"))
+}
+
+// raw HTML (see RenderOptions.AllowRawHTML)
+type rawHTMLFormat struct {
+	html string
+}
+
+func (*rawHTMLFormat) Fmt() *Format { return nil } // The body contains the entire element.
+
+func (*rawHTMLFormat) HasFormat(o *Op) bool {
+	return o.Type == "raw"
+}
+
+// rawHTMLFormat implements the FormatWriter interface.
+func (rf *rawHTMLFormat) Write(buf io.Writer) {
+	io.WriteString(buf, rf.html)
 }
 
 // strikethrough
-type strikeFormat struct{}
+type strikeFormat struct {
+	tag string // either "s" or "del"
+}
 
-func (*strikeFormat) Fmt() *Format {
+func (sf *strikeFormat) Fmt() *Format {
 	return &Format{
-		Val:   "s",
+		Val:   sf.tag,
 		Place: Tag,
 	}
 }
@@ -124,13 +344,15 @@ func (*strikeFormat) HasFormat(o *Op) bool {
 
 // background
 type bkgFormat struct {
-	c string
+	c     string
+	block bool // whether the background is set on a line break, coloring the whole block
 }
 
 func (bf *bkgFormat) Fmt() *Format {
 	return &Format{
 		Val:   "background-color:" + bf.c + ";",
 		Place: Style,
+		Block: bf.block,
 	}
 }
 
@@ -139,23 +361,68 @@ func (bf *bkgFormat) HasFormat(o *Op) bool {
 }
 
 // sizeFormat is used for inline strings of named sizes such as "huge" or "small".
-type sizeFormat string
+type sizeFormat struct {
+	size   string
+	prefix string // the class name prefix
+	style  string // the font-size value to write as a style instead of a class (if set)
+}
+
+func (sf *sizeFormat) Fmt() *Format {
+	if sf.style != "" {
+		return &Format{
+			Val:   "font-size:" + sf.style + ";",
+			Place: Style,
+		}
+	}
+	return &Format{
+		Val:   sf.prefix + "size-" + sf.size,
+		Place: Class,
+	}
+}
 
-func (sf sizeFormat) Fmt() *Format {
+func (sf *sizeFormat) HasFormat(o *Op) bool {
+	return o.Attrs["size"] == sf.size
+}
+
+// fontFormat is used for inline strings of named fonts such as "serif" or "monospace".
+type fontFormat struct {
+	font   string
+	prefix string // the class name prefix
+}
+
+func (ff *fontFormat) Fmt() *Format {
 	return &Format{
-		Val:   "ql-size-" + string(sf),
+		Val:   ff.prefix + "font-" + ff.font,
 		Place: Class,
 	}
 }
 
-func (sf sizeFormat) HasFormat(o *Op) bool {
-	return o.Attrs["size"] == string(sf)
+func (ff *fontFormat) HasFormat(o *Op) bool {
+	return o.Attrs["font"] == ff.font
+}
+
+// font family written as a style
+type fontStyleFormat struct {
+	font   string // the attribute value
+	family string // the validated list of families
+}
+
+func (ff *fontStyleFormat) Fmt() *Format {
+	return &Format{
+		Val:   "font-family:" + ff.family + ";",
+		Place: Style,
+	}
+}
+
+func (ff *fontStyleFormat) HasFormat(o *Op) bool {
+	return o.Attrs["font"] == ff.font
 }
 
 // script (sup and sub)
 
 type scriptFormat struct {
-	t string
+	t   string // the tag name
+	val string // the value of the "script" attribute
 }
 
 func (sf *scriptFormat) Fmt() *Format {
@@ -165,6 +432,35 @@ func (sf *scriptFormat) Fmt() *Format {
 	}
 }
 
-func (*scriptFormat) HasFormat(o *Op) bool {
-	return o.HasAttr("script")
+func (sf *scriptFormat) HasFormat(o *Op) bool {
+	return o.Attrs["script"] == sf.val
+}
+
+// unknown inline attributes written as data-* attributes of a span (see RenderOptions.PreserveUnknownAttrs)
+type dataSpanFormat struct {
+	names []string // the names of the attributes, sorted
+	attrs string   // the data-* attributes, each preceded by a space
+}
+
+func (*dataSpanFormat) Fmt() *Format { return new(Format) } // Only a wrapper.
+
+func (*dataSpanFormat) HasFormat(*Op) bool {
+	return false // Only a wrapper.
+}
+
+func (df *dataSpanFormat) Wrap() (string, string) {
+	return "<span" + df.attrs + ">", "</span>"
+}
+
+func (df *dataSpanFormat) Open(open []*Format, _ *Op) bool {
+	for _, f := range open {
+		if ds, ok := f.fm.(*dataSpanFormat); ok && ds.attrs == df.attrs {
+			return false // The span is already open.
+		}
+	}
+	return true
+}
+
+func (df *dataSpanFormat) Close(_ []*Format, o *Op, doingBlock bool) bool {
+	return doingBlock || dataAttrs(o, df.names) != df.attrs
 }
@@ -0,0 +1,344 @@
+package quill
+
+import (
+	"bytes"
+	"encoding/json"
+	"html"
+	"strconv"
+	"strings"
+)
+
+// RenderMarkdown takes a Delta array of insert operations and returns the content written as Markdown. Headers, block
+// quotes, lists, code blocks, and dividers are written as Markdown blocks; bold, italic, strikethrough, inline code,
+// links, and images are written inline. Formats that Markdown does not have (such as colors) are left out, and the
+// custom formats of RenderExtended are not used. The URLs of links and images are checked as they are by Render: a link
+// with a URL that is not allowed is written as plain text, and an image with a source that is not allowed is left out.
+// If an error occurs, any Markdown already written is returned.
+func RenderMarkdown(ops []byte) ([]byte, error) {
+	return RenderMarkdownWithOptions(ops, MarkdownOptions{})
+}
+
+// MarkdownOptions configures how RenderMarkdownWithOptions writes a Delta as Markdown. The zero value writes the same
+// Markdown as RenderMarkdown.
+type MarkdownOptions struct {
+	// HTMLSpans writes the inline formats that Markdown does not have (text color, background color, and size) as HTML
+	// <span> elements with inline styles, as in <span style="color:red;">text</span>. By default, these formats are
+	// left out.
+	HTMLSpans bool
+
+	// AllowedSchemes lists the URL schemes that links and image sources may have, like RenderOptions.AllowedSchemes.
+	// If AllowedSchemes is nil, DefaultAllowedSchemes is used.
+	AllowedSchemes []string
+}
+
+// RenderMarkdownWithOptions is like RenderMarkdown but writes the Markdown as configured by opts.
+func RenderMarkdownWithOptions(ops []byte, opts MarkdownOptions) ([]byte, error) {
+
+	raw := make([]rawOp, 0, 12)
+	if err := json.Unmarshal(ops, &raw); err != nil {
+		return nil, err
+	}
+
+	md := &markdownWriter{spans: opts.HTMLSpans, urls: RenderOptions{AllowedSchemes: opts.AllowedSchemes}}
+	o := Op{Attrs: make(map[string]string, 3)}
+
+	for i := range raw {
+
+		if err := raw[i].makeOp(&o, i); err != nil {
+			return md.out.Bytes(), err
+		}
+
+		switch o.Type {
+		case "text":
+			lines := strings.Split(html.UnescapeString(o.Data), "\n")
+			for j := range lines {
+				if lines[j] != "" {
+					md.writeText(lines[j], &o)
+				}
+				if j < len(lines)-1 {
+					md.endBlock(&o)
+				}
+			}
+		case "image":
+			if md.urls.allowedImage(o.Data) {
+				md.setMarkers(&o, "", "")
+				md.line.WriteString("![" + markdownEscape(o.Attrs["alt"], false) + "](" + markdownURL(o.Data) + ")")
+			}
+		case "divider", "section-break":
+			md.line.WriteString("---")
+			md.plain.WriteString("---")
+		case "break":
+			// A hard line break, with emphasis closed before it and opened again after it.
+			md.closeMarkers(0)
+			md.line.WriteString("\\\n")
+			md.plain.WriteByte('\n')
+		}
+
+	}
+
+	// The last line of a Delta should end with a "\n" but may not.
+	if md.line.Len() > 0 {
+		md.endBlock(blankOp())
+	}
+	if md.code {
+		md.out.WriteString("```")
+	}
+	if md.out.Len() > 0 {
+		md.out.WriteByte('\n')
+	}
+
+	return md.out.Bytes(), nil
+
+}
+
+// A markdownWriter collects the lines of a Delta and writes them out as Markdown.
+type markdownWriter struct {
+	out   bytes.Buffer      // the final output
+	line  bytes.Buffer      // the Markdown of the current line
+	plain bytes.Buffer      // the plain text of the current line (used if the line is in a code block)
+	open  []markdownMarker  // the inline markers open in the current line in the order in which they were opened
+	prev  string            // the kind of block last written ("" at the start)
+	code  bool              // whether a fenced code block is open
+	lang  string            // the language of the open code block
+	spans bool              // whether formats that Markdown does not have are written as HTML spans
+	urls  RenderOptions     // the options with which the URLs of links and images are checked
+	want  [6]markdownMarker // reused array for the markers set on each op
+}
+
+// A markdownMarker is the Markdown syntax that surrounds text with an inline format.
+type markdownMarker struct {
+	start, end string
+}
+
+// markers lists the inline markers that should surround the text of the op, outermost first.
+func (md *markdownWriter) markers(o *Op, text string) []markdownMarker {
+	want := md.want[:0]
+	if href := o.Attrs["link"]; href != "" && md.urls.allowedURL(href) {
+		want = append(want, markdownMarker{"[", "](" + markdownURL(href) + ")"})
+	}
+	if md.spans {
+		if style := markdownSpanStyle(o); style != "" {
+			want = append(want, markdownMarker{`<span style="` + style + `">`, "</span>"})
+		}
+	}
+	if o.HasAttr("bold") {
+		want = append(want, markdownMarker{"**", "**"})
+	}
+	if o.HasAttr("italic") {
+		want = append(want, markdownMarker{"_", "_"})
+	}
+	if o.HasAttr("strike") {
+		want = append(want, markdownMarker{"~~", "~~"})
+	}
+	if o.HasAttr("code") {
+		want = append(want, codeMarker(text))
+	}
+	return want
+}
+
+// codeMarker gives the marker of an inline code span of the text. The span is fenced with more backticks than in the
+// longest run of backticks in the text, and a backtick at the start or end of the text is kept apart from the fence
+// by a space.
+func codeMarker(text string) markdownMarker {
+	fence := "`"
+	for strings.Contains(text, fence) {
+		fence += "`"
+	}
+	if strings.HasPrefix(text, "`") || strings.HasSuffix(text, "`") {
+		return markdownMarker{fence + " ", " " + fence}
+	}
+	return markdownMarker{fence, fence}
+}
+
+// setMarkers closes the open markers that the op does not have and opens the ones it has that are not open yet.
+// Leading spaces of the text (given as space) are written before any markers are opened.
+func (md *markdownWriter) setMarkers(o *Op, space, text string) {
+
+	want := md.markers(o, text)
+
+	// Find the first open marker that is not wanted; it and all markers opened after it are closed.
+	keep := 0
+	for ; keep < len(md.open); keep++ {
+		if !hasMarker(want, md.open[keep]) {
+			break
+		}
+	}
+	md.closeMarkers(keep)
+
+	md.line.WriteString(space)
+
+	for _, m := range want {
+		if !hasMarker(md.open, m) {
+			md.line.WriteString(m.start)
+			md.open = append(md.open, m)
+		}
+	}
+
+}
+
+// closeMarkers closes the open markers down to the first n, keeping trailing spaces outside of the closed markers.
+func (md *markdownWriter) closeMarkers(n int) {
+	if len(md.open) <= n {
+		return
+	}
+	text := md.line.Bytes()
+	trimmed := bytes.TrimRight(text, " ")
+	space := string(text[len(trimmed):])
+	md.line.Truncate(len(trimmed))
+	for i := len(md.open) - 1; i >= n; i-- {
+		md.line.WriteString(md.open[i].end)
+	}
+	md.line.WriteString(space)
+	md.open = md.open[:n]
+}
+
+// markdownSpanStyle gives the inline style for the formats of the op that Markdown does not have.
+func markdownSpanStyle(o *Op) string {
+	var style string
+	if c := o.Attrs["color"]; cssColor(c) {
+		style += "color:" + c + ";"
+	}
+	if bg := o.Attrs["background"]; cssColor(bg) {
+		style += "background-color:" + bg + ";"
+	}
+	size := o.Attrs["size"]
+	if !cssLength(size) {
+		size = namedSizes[size]
+	}
+	if size != "" {
+		style += "font-size:" + size + ";"
+	}
+	return style
+}
+
+func hasMarker(list []markdownMarker, m markdownMarker) bool {
+	for i := range list {
+		if list[i] == m {
+			return true
+		}
+	}
+	return false
+}
+
+// writeText writes the text of an op (not containing any line breaks) to the current line.
+func (md *markdownWriter) writeText(text string, o *Op) {
+	md.plain.WriteString(text)
+	trimmed := strings.TrimLeft(text, " ")
+	md.setMarkers(o, text[:len(text)-len(trimmed)], trimmed)
+	if o.HasAttr("code") {
+		md.line.WriteString(trimmed)
+		return
+	}
+	md.line.WriteString(markdownEscape(trimmed, md.line.Len() == 0))
+}
+
+// endBlock writes out the current line as a block with the block formats of o.
+func (md *markdownWriter) endBlock(o *Op) {
+
+	md.closeMarkers(0)
+	defer func() {
+		md.line.Reset()
+		md.plain.Reset()
+	}()
+
+	if o.HasAttr("code-block") {
+		lang := codeLanguage(o)
+		if !md.code || lang != md.lang {
+			md.separate("code")
+			md.out.WriteString("```" + lang + "\n")
+			md.code, md.lang = true, lang
+		}
+		md.out.WriteString(codeIndent(o))
+		md.out.Write(md.plain.Bytes())
+		md.out.WriteByte('\n')
+		return
+	}
+
+	if md.code {
+		md.out.WriteString("```")
+		md.code = false
+	}
+
+	var kind, prefix string
+	switch {
+	case o.Attrs["header"] != "":
+		level, _ := strconv.Atoi(o.Attrs["header"])
+		if level < 1 || level > 6 {
+			level = 1
+		}
+		kind, prefix = "header", strings.Repeat("#", level)+" "
+	case o.HasAttr("blockquote"):
+		kind, prefix = "quote", "> "
+	case listItem(o):
+		indent, _ := strconv.Atoi(o.Attrs["indent"])
+		kind, prefix = "list", strings.Repeat("    ", indent)
+		switch o.Attrs["list"] {
+		case "ordered":
+			prefix += "1. "
+		case "checked":
+			prefix += "- [x] "
+		case "unchecked":
+			prefix += "- [ ] "
+		default:
+			prefix += "- "
+		}
+	default:
+		if md.line.Len() == 0 {
+			return // Blank lines are only written as the space between blocks.
+		}
+		kind = "p"
+	}
+
+	md.separate(kind)
+	md.out.WriteString(prefix)
+	md.out.Write(md.line.Bytes())
+
+}
+
+// separate writes the line breaks needed between the previous block and a block of the given kind.
+func (md *markdownWriter) separate(kind string) {
+	if md.prev != "" {
+		if kind == "list" && md.prev == "list" {
+			md.out.WriteByte('\n')
+		} else {
+			md.out.WriteString("\n\n")
+		}
+	}
+	md.prev = kind
+}
+
+// markdownEscape escapes the characters of text that would otherwise be read as Markdown syntax. If lineStart is true,
+// the text is at the start of a line, where more characters have a meaning.
+func markdownEscape(text string, lineStart bool) string {
+	var esc strings.Builder
+	if lineStart {
+		switch {
+		case strings.HasPrefix(text, "#"), strings.HasPrefix(text, "-"), strings.HasPrefix(text, "+"):
+			esc.WriteByte('\\')
+		default:
+			// An ordered list item starts with digits and a period.
+			digits := 0
+			for digits < len(text) && text[digits] >= '0' && text[digits] <= '9' {
+				digits++
+			}
+			if digits > 0 && digits < len(text) && text[digits] == '.' {
+				esc.WriteString(text[:digits])
+				text = text[digits:]
+				esc.WriteByte('\\')
+			}
+		}
+	}
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '\\', '*', '_', '`', '[', ']', '<', '>', '~':
+			esc.WriteByte('\\')
+		}
+		esc.WriteByte(text[i])
+	}
+	return esc.String()
+}
+
+// markdownURL escapes the characters that would end a URL in a Markdown link or image.
+func markdownURL(u string) string {
+	return strings.NewReplacer(" ", "%20", "(", "%28", ")", "%29").Replace(u)
+}
@@ -0,0 +1,170 @@
+package quill
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func TestRenderMarkdown(t *testing.T) {
+
+	pairNames := []string{"ops1", "list1", "code1", "markdown1"}
+
+	for _, n := range pairNames {
+		t.Run(n, func(t *testing.T) {
+
+			ops, err := ioutil.ReadFile("./testdata/" + n + ".json")
+			if err != nil {
+				t.Fatalf("could not read %s.json; %s", n, err)
+			}
+
+			want, err := ioutil.ReadFile("./testdata/" + n + ".md")
+			if err != nil {
+				t.Fatalf("could not read %s.md; %s", n, err)
+			}
+
+			got, err := RenderMarkdown(ops)
+			if err != nil {
+				t.Fatalf("error rendering; %s", err)
+			}
+
+			if !bytes.Equal(got, want) {
+				t.Errorf("bad rendering; \nexpected: \n%s\ngot: \n%s\n", want, got)
+			}
+
+		})
+	}
+
+}
+
+func TestRenderMarkdownWithOptions(t *testing.T) {
+
+	ops := []byte(`[{"insert":"plain "},{"attributes":{"color":"red","bold":true},"insert":"red bold"},{"insert":" "},` +
+		`{"attributes":{"background":"#ff0","size":"large"},"insert":"large"},{"insert":" "},` +
+		`{"attributes":{"color":"red\"><script>"},"insert":"bad color"},{"insert":"\n"}]`)
+
+	cases := []struct {
+		opts MarkdownOptions
+		want string
+	}{
+		{MarkdownOptions{}, "plain **red bold** large bad color\n"},
+		{
+			MarkdownOptions{HTMLSpans: true},
+			`plain <span style="color:red;">**red bold**</span> <span style="background-color:#ff0;font-size:1.5em;">large</span>` +
+				" bad color\n",
+		},
+	}
+
+	for i, tc := range cases {
+		got, err := RenderMarkdownWithOptions(ops, tc.opts)
+		if err != nil {
+			t.Fatalf("(index %d) %s", i, err)
+		}
+		if string(got) != tc.want {
+			t.Errorf("(index %d) bad rendering; \nexpected: \n%s\ngot: \n%s\n", i, tc.want, got)
+		}
+	}
+
+	// The URLs of links are checked with HTML spans written too.
+	ops = []byte(`[{"attributes":{"color":"red","link":"javascript:alert(1)"},"insert":"click"},{"insert":" "},` +
+		`{"attributes":{"link":"ftp://widerwebs.com"},"insert":"files"},{"insert":"\n"}]`)
+
+	cases = []struct {
+		opts MarkdownOptions
+		want string
+	}{
+		{MarkdownOptions{HTMLSpans: true}, `<span style="color:red;">click</span> files` + "\n"},
+		{
+			MarkdownOptions{HTMLSpans: true, AllowedSchemes: []string{"ftp"}},
+			`<span style="color:red;">click</span> [files](ftp://widerwebs.com)` + "\n",
+		},
+	}
+
+	for i, tc := range cases {
+		got, err := RenderMarkdownWithOptions(ops, tc.opts)
+		if err != nil {
+			t.Fatalf("(index %d) %s", i, err)
+		}
+		if string(got) != tc.want {
+			t.Errorf("(index %d) bad rendering; \nexpected: \n%s\ngot: \n%s\n", i, tc.want, got)
+		}
+	}
+
+}
+
+func TestRenderMarkdown_break(t *testing.T) {
+
+	ops := []byte(`[{"insert":"first line"},{"insert":{"break":true}},{"insert":"second","attributes":{"bold":true}},` +
+		`{"insert":{"break":true},"attributes":{"bold":true}},{"insert":"third","attributes":{"bold":true}},{"insert":"\n"}]`)
+
+	got, err := RenderMarkdown(ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "first line\\\n**second**\\\n**third**\n"; string(got) != want {
+		t.Errorf("bad rendering; \nexpected: \n%s\ngot: \n%s\n", want, got)
+	}
+
+}
+
+func TestRenderMarkdown_inline(t *testing.T) {
+
+	cases := []struct {
+		ops  string
+		want string
+	}{
+		{
+			`[{"insert":"click","attributes":{"link":"javascript:alert(1)"}},{"insert":" or "},` +
+				`{"insert":"here","attributes":{"link":"https://widerwebs.com"}},{"insert":"\n"}]`,
+			"click or [here](https://widerwebs.com)\n",
+		},
+		{
+			`[{"insert":{"image":"javascript:alert(1)"}},{"insert":{"image":"cat.png"},"attributes":{"alt":"A [cat]"}},{"insert":"\n"}]`,
+			"![A \\[cat\\]](cat.png)\n",
+		},
+		{
+			`[{"insert":"run "},{"insert":"a ` + "`" + `b` + "``" + ` c","attributes":{"code":true}},{"insert":"\n"}]`,
+			"run ```a `b`` c```\n",
+		},
+		{
+			`[{"insert":"` + "`" + `tick","attributes":{"code":true}},{"insert":"\n"}]`,
+			"`` `tick ``\n",
+		},
+	}
+
+	for i, tc := range cases {
+		got, err := RenderMarkdown([]byte(tc.ops))
+		if err != nil {
+			t.Fatalf("(index %d) %s", i, err)
+		}
+		if string(got) != tc.want {
+			t.Errorf("(index %d) bad rendering; \nexpected: \n%s\ngot: \n%s\n", i, tc.want, got)
+		}
+	}
+
+}
+
+func TestMarkdownEscape(t *testing.T) {
+
+	cases := []struct {
+		text      string
+		lineStart bool
+		want      string
+	}{
+		{"plain text", true, "plain text"},
+		{"a *b* _c_", false, `a \*b\* \_c\_`},
+		{"# title", true, `\# title`},
+		{"# title", false, "# title"},
+		{"- item", true, `\- item`},
+		{"12. item", true, `12\. item`},
+		{"12 items", true, "12 items"},
+		{"<b>[x]</b>", false, `\<b\>\[x\]\</b\>`},
+	}
+
+	for i, tc := range cases {
+		if got := markdownEscape(tc.text, tc.lineStart); got != tc.want {
+			t.Errorf("(index %d) wanted %s; got: %s", i, tc.want, got)
+		}
+	}
+
+}
@@ -0,0 +1,44 @@
+package quill
+
+import (
+	"encoding/json"
+)
+
+// A Media is an image or video embedded in a Delta.
+type Media struct {
+	Type string // "image" or "video"
+	URL  string
+}
+
+// MediaURLs takes a Delta array of insert operations and returns the images and videos embedded in it, in order,
+// without rendering the Delta. A video may be given either as the URL or as an object with the URL under "url".
+// If an error occurs, the media found before it are returned.
+func MediaURLs(ops []byte) ([]Media, error) {
+
+	raw := make([]rawOp, 0, 12)
+	if err := json.Unmarshal(ops, &raw); err != nil {
+		return nil, err
+	}
+
+	var media []Media
+	o := Op{Attrs: make(map[string]string, 3)}
+
+	for i := range raw {
+		if err := raw[i].makeOp(&o, i); err != nil {
+			return media, err
+		}
+		switch o.Type {
+		case "image", "video":
+			u := o.Data
+			if obj, ok := o.RawData.(map[string]interface{}); ok {
+				u, _ = obj["url"].(string)
+			}
+			if u != "" {
+				media = append(media, Media{Type: o.Type, URL: u})
+			}
+		}
+	}
+
+	return media, nil
+
+}
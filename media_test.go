@@ -0,0 +1,34 @@
+package quill
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMediaURLs(t *testing.T) {
+
+	ops := []byte(`[{"insert":"Intro\n"},{"insert":{"image":"https://example.com/a.png"},"attributes":{"alt":"A"}},` +
+		`{"insert":"\n"},{"insert":{"video":"https://example.com/v1.mp4"}},{"insert":{"divider":true}},` +
+		`{"insert":{"video":{"url":"https://example.com/v2.mp4","width":300}}},{"insert":{"image":"data:image/png;base64,AAAA"}},` +
+		`{"insert":"\n"}]`)
+
+	want := []Media{
+		{"image", "https://example.com/a.png"},
+		{"video", "https://example.com/v1.mp4"},
+		{"video", "https://example.com/v2.mp4"},
+		{"image", "data:image/png;base64,AAAA"},
+	}
+
+	got, err := MediaURLs(ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("wanted %v; got %v", want, got)
+	}
+
+	if got, err = MediaURLs([]byte(`[{"insert":"text\n"}]`)); err != nil || len(got) != 0 {
+		t.Errorf("got %v (error %v) for a Delta without media", got, err)
+	}
+
+}
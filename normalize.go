@@ -0,0 +1,101 @@
+package quill
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// NormalizeDelta takes a Delta array of insert operations and returns it in a canonical form, which is useful for caching,
+// deduplicating, and diffing documents. In the canonical form:
+//   - attributes that have no effect (with a false, null, or empty string value) are removed;
+//   - every "\n" is an op of its own, carrying the attributes of the op in which it was given;
+//   - adjacent text inserts (other than "\n") with identical attributes are merged into a single op;
+//   - empty text inserts are removed.
+func NormalizeDelta(ops []byte) ([]byte, error) {
+
+	raw := make([]rawOp, 0, 12)
+	if err := json.Unmarshal(ops, &raw); err != nil {
+		return nil, err
+	}
+
+	o := Op{Attrs: make(map[string]string, 3)}
+	norm := make([]rawOp, 0, len(raw))
+
+	for i := range raw {
+
+		if err := raw[i].makeOp(&o, i); err != nil {
+			return nil, err
+		}
+
+		attrs := effectiveAttrs(raw[i].Attrs)
+
+		text, ok := raw[i].Insert.(string)
+		if !ok {
+			norm = append(norm, rawOp{Insert: raw[i].Insert, Attrs: attrs})
+			continue
+		}
+
+		for text != "" {
+
+			if text[0] == '\n' {
+				norm = append(norm, rawOp{Insert: "\n", Attrs: attrs})
+				text = text[1:]
+				continue
+			}
+
+			part := text
+			if nl := strings.IndexByte(text, '\n'); nl != -1 {
+				part = text[:nl]
+			}
+			text = text[len(part):]
+
+			// Merge the text into the previous op if possible.
+			if n := len(norm); n > 0 {
+				if prev, ok := norm[n-1].Insert.(string); ok && prev != "\n" && reflect.DeepEqual(norm[n-1].Attrs, attrs) {
+					norm[n-1].Insert = prev + part
+					continue
+				}
+			}
+
+			norm = append(norm, rawOp{Insert: part, Attrs: attrs})
+
+		}
+
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(norm); err != nil {
+		return nil, err
+	}
+
+	return bytes.TrimSuffix(buf.Bytes(), []byte{'\n'}), nil
+
+}
+
+// effectiveAttrs returns a copy of the attributes without those that have no effect, or nil if no attributes remain.
+func effectiveAttrs(attrs map[string]interface{}) map[string]interface{} {
+	var eff map[string]interface{}
+	for k, v := range attrs {
+		switch val := v.(type) {
+		case nil:
+			continue
+		case bool:
+			if !val {
+				continue
+			}
+		case string:
+			if val == "" {
+				continue
+			}
+		}
+		if eff == nil {
+			eff = make(map[string]interface{}, len(attrs))
+		}
+		eff[k] = v
+	}
+	return eff
+}
@@ -0,0 +1,47 @@
+package quill
+
+import (
+	"testing"
+)
+
+func TestNormalizeDelta(t *testing.T) {
+
+	cases := map[string]struct {
+		ops  string
+		want string
+	}{
+		"merge adjacent": {
+			ops:  `[{"insert":"Hello "},{"insert":"world","attributes":{}},{"insert":"!\n"}]`,
+			want: `[{"insert":"Hello world!"},{"insert":"\n"}]`,
+		},
+		"split newlines": {
+			ops:  `[{"insert":"line1\nline2\n\n"},{"insert":"h"},{"attributes":{"header":1},"insert":"\n"}]`,
+			want: `[{"insert":"line1"},{"insert":"\n"},{"insert":"line2"},{"insert":"\n"},{"insert":"\n"},{"insert":"h"},{"insert":"\n","attributes":{"header":1}}]`,
+		},
+		"no-op attributes": {
+			ops:  `[{"insert":"a","attributes":{"bold":false,"italic":null,"color":""}},{"insert":"b","attributes":{"bold":true,"italic":false}},{"insert":"c","attributes":{"bold":true}},{"insert":"\n"}]`,
+			want: `[{"insert":"a"},{"insert":"bc","attributes":{"bold":true}},{"insert":"\n"}]`,
+		},
+		"embeds and empty text": {
+			ops:  `[{"insert":"<b> & "},{"insert":""},{"insert":{"image":"x.png"},"attributes":{"width":"30"}},{"insert":" after"},{"insert":"\n"}]`,
+			want: `[{"insert":"<b> & "},{"insert":{"image":"x.png"},"attributes":{"width":"30"}},{"insert":" after"},{"insert":"\n"}]`,
+		},
+	}
+
+	for k, tc := range cases {
+		t.Run(k, func(t *testing.T) {
+			got, err := NormalizeDelta([]byte(tc.ops))
+			if err != nil {
+				t.Fatalf("%s", err)
+			}
+			if string(got) != tc.want {
+				t.Errorf("bad normalization; got: %s", got)
+			}
+		})
+	}
+
+	if _, err := NormalizeDelta([]byte(`[{"insert":null}]`)); err == nil {
+		t.Errorf("expected an error for an op without an insert")
+	}
+
+}
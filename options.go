@@ -0,0 +1,439 @@
+package quill
+
+import (
+	"html"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// RenderOptions configures how RenderWithOptions renders a Delta. The zero value renders the same HTML as Render.
+type RenderOptions struct {
+	// CustomFormats may provide a Formatter to customize the way certain kinds of inserts are rendered (see RenderExtended).
+	CustomFormats func(string, *Op) Formatter
+
+	// FormatTemplates gives the elements to write for some formats by keyword (an insert type such as "text" or an
+	// attribute name such as "bold" or "header"), as a lighter-weight way than CustomFormats to change the HTML written
+	// for a format. A template is used for an op unless CustomFormats or a registered format gives a Formatter for it.
+	FormatTemplates map[string]FormatTemplate
+
+	// EmptyParagraph says what is written inside of a paragraph that has no content.
+	EmptyParagraph EmptyParagraph
+
+	// QuoteAttribution wraps block quotes in a <figure> element. A line with the "attribution" attribute that follows
+	// a block quote is written as a <cite> element within the figure; one that does not follow a block quote is written
+	// as a paragraph.
+	QuoteAttribution bool
+
+	// StripEmpty removes inline elements (such as <span></span> or <strong></strong>) that have no content.
+	StripEmpty bool
+
+	// ImagePicture writes images that have alternate sources in a <picture> element with a <source> for each of the
+	// alternates. An alternate source is given by an attribute named "source-" followed by the image type, such as
+	// {"source-webp": "https://example.com/image.webp"}.
+	ImagePicture bool
+
+	// InlineFonts writes the "font" attribute as a "font-family" style. Only font family lists made up of plain names
+	// are written; any other value of the attribute is ignored. By default, the font is given as a class such as
+	// "ql-font-monospace".
+	InlineFonts bool
+
+	// VoidStyle says how void elements (such as <br>, <hr>, <img>, and <source>) are closed. By default, HTML5 style
+	// is used, writing void elements without a closing slash.
+	VoidStyle VoidStyle
+
+	// SelfClosing lists the void elements (by tag name, such as "br", "hr", "img", and "source") to write with a
+	// self-closing slash, like <br/>. An element listed in SelfClosing is written as set here regardless of VoidStyle.
+	SelfClosing map[string]bool
+
+	// IndentStyle writes the "indent" attribute of blocks (including list items) as a "padding-left" style instead of
+	// a class. The padding is IndentPerLevel (3 by default) of IndentUnit ("em" by default) for each level of indent.
+	IndentStyle    bool
+	IndentUnit     string
+	IndentPerLevel float64
+
+	// BlockText, if set, transforms the text of each block before the block is written. It is called for each run of
+	// text between the tags within the block with the tag name of the block element ("pre" for the lines of a code
+	// block) and the plain (unescaped) text. The text it returns is escaped.
+	BlockText func(blockType, text string) string
+
+	// ListLabel, if set, gives the "aria-label" of each list given the op ending the first item of the list. A label
+	// set with the "aria-label" attribute on the first item is used instead if there is one.
+	ListLabel func(*Op) string
+
+	// TransformOp, if set, is called with each op before it is filtered and rendered, and it may change the Data, Type,
+	// and Attrs of the op (such as to rewrite image hosts). The Data of a text op is given as plain text and is escaped
+	// after TransformOp returns.
+	TransformOp func(*Op)
+
+	// Filter, if set, is called with each op before it is rendered. If it returns false, the op is skipped entirely.
+	// Note that skipping an op holding a "\n" merges the blocks on either side of it.
+	Filter func(*Op) bool
+
+	// SiteOrigin is the origin (such as "https://example.com") of the site on which the HTML is shown. If it is set,
+	// only links to other hosts get the LinkTarget (with rel="noopener" if it is "_blank"); links to the same host or
+	// relative links do not. If it is not set, all links get the LinkTarget, which by default opens a new tab.
+	SiteOrigin string
+
+	// MaxInlineDepth, if positive, limits how many inline formats may be open at once (nested within each other). Any
+	// more formats applied to the text are dropped, keeping the formats that are sorted first (links before tags, and
+	// tags before classes and styles).
+	MaxInlineDepth int
+
+	// HeaderIDs gives each header an id attribute made from its text so that it can be linked to. The ID is made by
+	// HeaderSlug or, if HeaderSlug is nil, by lowercasing the text, dropping punctuation, and joining the words with
+	// hyphens. A number is added to the ID of a header that would have the same ID as an earlier header, as in
+	// "usage-1". A header for which the slug is empty gets no ID.
+	HeaderIDs  bool
+	HeaderSlug func(text string) string
+
+	// HeaderAnchors gives each header an id (like HeaderIDs does) and writes a link to the header at the start of it.
+	// The link is written by HeaderAnchor or, if HeaderAnchor is nil, it is <a class="anchor" href="#id"></a>.
+	HeaderAnchors bool
+	HeaderAnchor  func(id string) string
+
+	// SectionBreak is the HTML written for a "section-break" embed. By default it is
+	// <div class="section-break">* * *</div>.
+	SectionBreak string
+
+	// MergeLists drops blank lines between list items of the same type so that the items stay in a single list.
+	// By default, a blank line between two lists is written as an empty paragraph separating the lists.
+	MergeLists bool
+
+	// StyleFirst writes the style attribute of block elements before the class attribute. By default, the class
+	// attribute is written first, as in <p class="ql-align-center" style="color:red;">.
+	StyleFirst bool
+
+	// Sanitizer, if set, is given the rendered HTML as a last step and returns the HTML to output. Use it to run an HTML
+	// sanitizer (such as the bluemonday adapter in the bluemonday subdirectory) over the output as a defense beyond the
+	// checks done while rendering. RenderWithSourceMap does not allow it because the offsets cannot follow the changes.
+	Sanitizer func(html []byte) []byte
+
+	// CodeLanguageLabel writes the language of a code block (given as the value of the "code-block" attribute) in a
+	// label element before the <pre> tag, as in <div class="code-lang">javascript</div>.
+	CodeLanguageLabel bool
+
+	// DebugOpIndex adds a data-op-index attribute to each block element giving the index of the op that ends the block.
+	// This is meant only for troubleshooting the rendering of a Delta.
+	DebugOpIndex bool
+
+	// MaxImageWidth and MaxImageHeight, if above 0, limit the width and height (in pixels) written for images.
+	// An image given a larger size is scaled down, keeping its aspect ratio if both dimensions are given.
+	MaxImageWidth  int
+	MaxImageHeight int
+
+	// AllowedSchemes lists the URL schemes that links and image sources may have. Relative URLs are always allowed, and
+	// images may also have data URIs of common image types (such as "data:image/png;base64,..."). A link with a URL that
+	// is not allowed is rendered as plain text, and an image with a source that is not allowed is left out.
+	// If AllowedSchemes is nil, DefaultAllowedSchemes is used.
+	AllowedSchemes []string
+
+	// ClassPrefix is the prefix of the class names given to formats such as sizes and alignments, as in "ql-size-large".
+	// If ClassPrefix is empty, "ql-" is used, which is what the Quill stylesheets use.
+	ClassPrefix string
+
+	// LinkTarget is the target attribute of links. If LinkTarget is empty, "_blank" is used.
+	LinkTarget string
+
+	// InlineStyles writes text alignment and the named sizes (small, large, and huge) as inline styles instead of
+	// classes, for HTML shown without the Quill stylesheets (such as in emails).
+	InlineStyles bool
+
+	// PreserveUnknownAttrs writes the attributes of ops that no format renders as data-* attributes, such as
+	// data-foo="bar" for {"foo":"bar"}. The attributes of an op holding only line breaks are written on the block
+	// element; those of other ops are written on a <span>. Attributes with names that are not made up of lowercase
+	// letters, digits, hyphens, underscores, and periods are left out.
+	PreserveUnknownAttrs bool
+
+	// UnwrapParagraphs writes plain paragraphs (text blocks with no block attributes) without a <p> tag, for content
+	// shown inline (such as a one-line comment). Paragraphs following each other are separated with <br> tags, so a
+	// Delta like [{"insert":"hello\nworld\n"}] is rendered as hello<br>world.
+	UnwrapParagraphs bool
+
+	// ParagraphTag is the tag name of the element written for plain text blocks. If ParagraphTag is empty, "p" is used.
+	ParagraphTag string
+
+	// SemanticTags writes the "strike" attribute as <del> (deleted text) and the "underline" attribute as <ins>
+	// (inserted text) instead of the presentational <s> and <u> tags.
+	SemanticTags bool
+
+	// PreserveWhitespace gives blocks with white space that HTML would collapse (leading spaces, tabs, or runs of spaces)
+	// a "white-space:pre-wrap;" style so that the spacing is shown as it was typed.
+	PreserveWhitespace bool
+
+	// SkipInvalidOps skips ops that cannot be rendered (such as {"insert":null} or an embed of a type with no format)
+	// instead of stopping with a RenderError, so that one bad op does not discard the whole document. The ops skipped
+	// are reported as warnings by RenderWithWarnings.
+	SkipInvalidOps bool
+
+	// TrimTrailingEmpty drops a single empty paragraph at the end of the document, such as the one that a Delta like
+	// [{"insert":"text\n\n"}] would otherwise end with. Empty paragraphs between other blocks are kept.
+	TrimTrailingEmpty bool
+
+	// Escaping says how the special characters in text are escaped. By default, EscapeNamed is used.
+	Escaping Escaping
+
+	// LazyImages adds loading="lazy" and decoding="async" attributes to images so that browsers load and decode them
+	// only as they are needed.
+	LazyImages bool
+
+	// AutoLink writes the bare http and https URLs in text as links (with the LinkTarget). Text that already has the
+	// "link" attribute, inline code, and code blocks are not changed. Punctuation at the end of a URL, such as a period
+	// ending a sentence, is not made part of the link. A URL directly followed by text with other formats (so that it is
+	// not clear where the URL ends) is not linked.
+	AutoLink bool
+
+	// RootClass, if set, wraps the whole output in a <div> element with the class, such as "ql-editor" so that the
+	// Quill stylesheets apply to the HTML as they do in the editor.
+	RootClass string
+
+	// AllowRawHTML writes the value of each "raw" embed (such as {"insert":{"raw":"<custom-widget></custom-widget>"}})
+	// into the output verbatim. By default, raw embeds are left out. WARNING: the HTML is not escaped or checked in any
+	// way, so a Delta with a raw embed can run any script on the page (XSS). Enable it only for Deltas that come from a
+	// trusted source, or along with a Sanitizer.
+	AllowRawHTML bool
+
+	// StandaloneImages says how an image that is alone on its line (and is not a link) is written. By default, it is
+	// written in a paragraph like any other line. An image on a line along with text always stays in the paragraph.
+	StandaloneImages ImageBlock
+}
+
+// DefaultAllowedSchemes lists the URL schemes allowed in links and image sources if RenderOptions.AllowedSchemes is nil.
+var DefaultAllowedSchemes = []string{"http", "https", "mailto", "tel"}
+
+// WithIndentUnit returns a copy of the options with the unit and the amount of padding for each level of indent set.
+func (opts RenderOptions) WithIndentUnit(unit string, perLevel float64) RenderOptions {
+	opts.IndentUnit = unit
+	opts.IndentPerLevel = perLevel
+	return opts
+}
+
+// WithSanitizer returns a copy of the options with the Sanitizer set.
+func (opts RenderOptions) WithSanitizer(sanitize func(html []byte) []byte) RenderOptions {
+	opts.Sanitizer = sanitize
+	return opts
+}
+
+// An EmptyParagraph is the content written inside of a paragraph that has no content so that the line is not collapsed.
+type EmptyParagraph uint8
+
+const (
+	EmptyBreak       EmptyParagraph = iota // write "<br>"
+	EmptyBreakClosed                       // write "<br/>"
+	EmptyNbsp                              // write "&nbsp;"
+	EmptyNone                              // write nothing (leaving "<p></p>")
+)
+
+// emptyParagraph gives the text to write inside of an empty paragraph.
+func (opts *RenderOptions) emptyParagraph() string {
+	switch opts.EmptyParagraph {
+	case EmptyBreak:
+		return "<br" + opts.voidEnd("br")
+	case EmptyBreakClosed:
+		return "<br/>"
+	case EmptyNbsp:
+		return "&nbsp;"
+	case EmptyNone:
+		return ""
+	}
+	return "<br>"
+}
+
+// An ImageBlock is a way of writing an image that is alone on its line.
+type ImageBlock uint8
+
+const (
+	ImageParagraph ImageBlock = iota // write the image in a paragraph, like <p><img src="x"></p>
+	ImageBare                        // write the image with no element around it, like <img src="x">
+	ImageFigure                      // write the image in a figure, like <figure><img src="x"></figure>
+)
+
+// A VoidStyle says how void elements are closed.
+type VoidStyle uint8
+
+const (
+	HTML5 VoidStyle = iota // write void elements without a slash, like <br>
+	XHTML                  // write void elements with a self-closing slash, like <br/>
+)
+
+// An Escaping is a way of escaping the special characters (<, >, &, ', and ") in text.
+type Escaping uint8
+
+const (
+	EscapeNamed   Escaping = iota // write named entities like &lt; and &amp; (with &#39; and &#34; for quotes)
+	EscapeNumeric                 // write numeric character references like &#60; and &#38;
+	EscapeASCII                   // write named entities and numeric character references for all non-ASCII characters
+)
+
+// escape escapes the text.
+func (esc Escaping) escape(text string) string {
+	switch esc {
+	case EscapeNumeric:
+		return numericEscaper.Replace(text)
+	case EscapeASCII:
+		var b strings.Builder
+		b.Grow(len(text))
+		for _, r := range html.EscapeString(text) {
+			if r < utf8.RuneSelf {
+				b.WriteRune(r)
+			} else {
+				b.WriteString("&#" + strconv.Itoa(int(r)) + ";")
+			}
+		}
+		return b.String()
+	}
+	return html.EscapeString(text)
+}
+
+// numericEscaper escapes the same characters as html.EscapeString, but with numeric character references.
+var numericEscaper = strings.NewReplacer(`&`, "&#38;", `'`, "&#39;", `<`, "&#60;", `>`, "&#62;", `"`, "&#34;")
+
+// voidEnd gives the end of the opening tag of a void element.
+func (opts *RenderOptions) voidEnd(tagName string) string {
+	selfClosing, ok := opts.SelfClosing[tagName]
+	if !ok {
+		selfClosing = opts.VoidStyle == XHTML
+	}
+	if selfClosing {
+		return "/>"
+	}
+	return ">"
+}
+
+// indentStyle gives the padding style for the indent level.
+func (opts *RenderOptions) indentStyle(level int) string {
+	unit, perLevel := opts.IndentUnit, opts.IndentPerLevel
+	if unit == "" {
+		unit = "em"
+	}
+	if perLevel <= 0 {
+		perLevel = 3
+	}
+	return "padding-left:" + strconv.FormatFloat(float64(level)*perLevel, 'f', -1, 64) + unit + ";"
+}
+
+// crossOrigin says if the link leads to a host other than that of the SiteOrigin.
+func (opts *RenderOptions) crossOrigin(href string) bool {
+	link, err := url.Parse(href)
+	if err != nil {
+		return true
+	}
+	if link.Host == "" {
+		return false // a relative link
+	}
+	site, err := url.Parse(opts.SiteOrigin)
+	if err != nil {
+		return true
+	}
+	return !strings.EqualFold(link.Host, site.Host)
+}
+
+// allowedURL says if the URL is relative or has one of the allowed schemes.
+func (opts *RenderOptions) allowedURL(u string) bool {
+	allowed := opts.AllowedSchemes
+	if allowed == nil {
+		allowed = DefaultAllowedSchemes
+	}
+	// Browsers ignore leading spaces and control characters and tabs and line breaks anywhere in a URL.
+	u = strings.Map(func(r rune) rune {
+		if r <= ' ' {
+			return -1
+		}
+		return r
+	}, u)
+	for i := 0; i < len(u); i++ {
+		switch u[i] {
+		case ':':
+			for _, scheme := range allowed {
+				if strings.EqualFold(u[:i], scheme) {
+					return true
+				}
+			}
+			return false
+		case '/', '?', '#':
+			return true // a relative URL
+		}
+	}
+	return true
+}
+
+// allowedImage says if the image source is an allowed URL or a data URI of an image.
+func (opts *RenderOptions) allowedImage(src string) bool {
+	if len(src) > 5 && strings.EqualFold(src[:5], "data:") {
+		// The media type ends at the first parameter or at the data.
+		mediaType := src[5:]
+		if end := strings.IndexAny(mediaType, ";,"); end != -1 {
+			mediaType = mediaType[:end]
+		}
+		if dataImageTypes[strings.ToLower(mediaType)] {
+			return true
+		}
+	}
+	return opts.allowedURL(src)
+}
+
+// dataImageTypes lists the media types of the data URIs allowed as image sources. SVG is not allowed because it may
+// contain scripts.
+var dataImageTypes = map[string]bool{
+	"image/avif": true,
+	"image/bmp":  true,
+	"image/gif":  true,
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/webp": true,
+}
+
+// classPrefix gives the prefix of the class names of formats.
+func (opts *RenderOptions) classPrefix() string {
+	if opts.ClassPrefix != "" {
+		return opts.ClassPrefix
+	}
+	return "ql-"
+}
+
+// paragraphTag gives the tag name of the element written for plain text blocks.
+func (opts *RenderOptions) paragraphTag() string {
+	if opts.ParagraphTag != "" {
+		return opts.ParagraphTag
+	}
+	return "p"
+}
+
+// linkTarget gives the target of links.
+func (opts *RenderOptions) linkTarget() string {
+	if opts.LinkTarget != "" {
+		return opts.LinkTarget
+	}
+	return "_blank"
+}
+
+// imageSize scales down the width and height of an image to fit within the maximum dimensions.
+// A dimension that is not known is given as 0.
+func (opts *RenderOptions) imageSize(width, height int) (int, int) {
+	if max := opts.MaxImageWidth; max > 0 && width > max {
+		height = (height*max + width/2) / width // rounded
+		width = max
+	}
+	if max := opts.MaxImageHeight; max > 0 && height > max {
+		width = (width*max + height/2) / height
+		height = max
+	}
+	return width, height
+}
+
+// headerSlug gives the ID of a header with the text (before it is made unique).
+func (opts *RenderOptions) headerSlug(text string) string {
+	if opts.HeaderSlug != nil {
+		return opts.HeaderSlug(text)
+	}
+	return slugify(text)
+}
+
+// headerAnchor gives the link to write inside of the header with the id.
+func (opts *RenderOptions) headerAnchor(id string) string {
+	if opts.HeaderAnchor != nil {
+		return opts.HeaderAnchor(id)
+	}
+	return `<a class="anchor" href=` + quoteAttr("#"+id) + `></a>`
+}
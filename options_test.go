@@ -0,0 +1,1510 @@
+package quill
+
+import (
+	"bytes"
+	"io/ioutil"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestRenderWithOptions(t *testing.T) {
+
+	cases := []struct {
+		name string
+		opts RenderOptions
+	}{
+		{"quote1", RenderOptions{QuoteAttribution: true}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+
+			ops, err := ioutil.ReadFile("./testdata/" + tc.name + ".json")
+			if err != nil {
+				t.Fatalf("could not read %s.json; %s", tc.name, err)
+			}
+
+			html, err := ioutil.ReadFile("./testdata/" + tc.name + ".html")
+			if err != nil {
+				t.Fatalf("could not read %s.html; %s", tc.name, err)
+			}
+
+			got, err := RenderWithOptions(ops, tc.opts)
+			if err != nil {
+				t.Errorf("error rendering; %v", err)
+			}
+
+			if !bytes.Equal(html, got) {
+				t.Errorf("bad rendering:\nwanted: \n%s\ngot: \n%s", html, got)
+			}
+
+		})
+	}
+
+}
+
+func TestRenderOptions_QuoteAttribution(t *testing.T) {
+
+	cases := map[string]struct {
+		ops  string
+		want string
+	}{
+		"no quote": {
+			ops:  `[{"insert":"Anonymous"},{"attributes":{"attribution":true},"insert":"\n"}]`,
+			want: "<p>Anonymous</p>",
+		},
+		"after a paragraph": {
+			ops: `[{"insert":"Quote"},{"attributes":{"blockquote":true},"insert":"\n"},{"insert":"Between\nAnonymous"},` +
+				`{"attributes":{"attribution":true},"insert":"\n"}]`,
+			want: "<figure><blockquote>Quote</blockquote></figure><p>Between</p><p>Anonymous</p>",
+		},
+		"second attribution": {
+			ops: `[{"insert":"Quote"},{"attributes":{"blockquote":true},"insert":"\n"},{"insert":"Author"},` +
+				`{"attributes":{"attribution":true},"insert":"\n"},{"insert":"Translator"},{"attributes":{"attribution":true},"insert":"\n"}]`,
+			want: "<figure><blockquote>Quote</blockquote><cite>Author</cite></figure><p>Translator</p>",
+		},
+	}
+
+	for k, tc := range cases {
+		t.Run(k, func(t *testing.T) {
+			got, err := RenderWithOptions([]byte(tc.ops), RenderOptions{QuoteAttribution: true})
+			if err != nil {
+				t.Fatalf("%s", err)
+			}
+			if string(got) != tc.want {
+				t.Errorf("bad rendering; got: %s", got)
+			}
+		})
+	}
+
+}
+
+func TestRenderOptions_EmptyParagraph(t *testing.T) {
+
+	const ops = `[{"insert": "line1\n\nline3\n"}]`
+
+	cases := map[EmptyParagraph]string{
+		EmptyBreak:       "<p>line1</p><p><br></p><p>line3</p>",
+		EmptyBreakClosed: "<p>line1</p><p><br/></p><p>line3</p>",
+		EmptyNbsp:        "<p>line1</p><p>&nbsp;</p><p>line3</p>",
+		EmptyNone:        "<p>line1</p><p></p><p>line3</p>",
+	}
+
+	for ep, want := range cases {
+		got, err := RenderWithOptions([]byte(ops), RenderOptions{EmptyParagraph: ep})
+		if err != nil {
+			t.Fatalf("(style %d) %s", ep, err)
+		}
+		if string(got) != want {
+			t.Errorf("(style %d) bad rendering; got: %s", ep, got)
+		}
+	}
+
+}
+
+func TestRenderOptions_StripEmpty(t *testing.T) {
+
+	cases := map[string]struct {
+		ops  string
+		want string
+	}{
+		"empty bold": {
+			ops:  `[{"insert":"a"},{"attributes":{"bold":true},"insert":""},{"insert":"b\n"}]`,
+			want: "<p>ab</p>",
+		},
+		"nested empty": {
+			ops:  `[{"insert":"a"},{"attributes":{"color":"red","italic":true,"link":"https://widerwebs.com"},"insert":""},{"insert":"\n"}]`,
+			want: "<p>a</p>",
+		},
+		"keep breaks": {
+			ops:  `[{"insert":"a\n\n"},{"attributes":{"size":"large"},"insert":""},{"insert":"b\n"}]`,
+			want: "<p>a</p><p><br></p><p>b</p>",
+		},
+		"empty line": {
+			ops:  `[{"insert":"a\n"},{"attributes":{"size":"large"},"insert":""},{"insert":"\n"}]`,
+			want: "<p>a</p><p><br></p>",
+		},
+	}
+
+	for k, tc := range cases {
+		t.Run(k, func(t *testing.T) {
+			got, err := RenderWithOptions([]byte(tc.ops), RenderOptions{StripEmpty: true})
+			if err != nil {
+				t.Fatalf("%s", err)
+			}
+			if string(got) != tc.want {
+				t.Errorf("bad rendering; got: %s", got)
+			}
+		})
+	}
+
+}
+
+func TestRenderOptions_ImagePicture(t *testing.T) {
+
+	ops := []byte(`[{"insert":{"image":"cat.jpg"},"attributes":{"source-webp":"cat.webp","source-avif":"cat.avif"}},{"insert":"\n"}]`)
+
+	got, err := RenderWithOptions(ops, RenderOptions{ImagePicture: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `<p><picture><source srcset="cat.avif" type="image/avif"><source srcset="cat.webp" type="image/webp">` +
+		`<img src="cat.jpg"></picture></p>`
+	if string(got) != want {
+		t.Errorf("bad rendering with option; got: %s", got)
+	}
+
+	got, err = Render(ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want = `<p><img src="cat.jpg"></p>`; string(got) != want {
+		t.Errorf("bad rendering without option; got: %s", got)
+	}
+
+}
+
+func TestRenderOptions_InlineFonts(t *testing.T) {
+
+	cases := map[string]struct {
+		ops  string
+		want string
+	}{
+		"generic": {
+			ops:  `[{"attributes":{"font":"monospace"},"insert":"mono"},{"insert":"\n"}]`,
+			want: `<p><span style="font-family:monospace;">mono</span></p>`,
+		},
+		"list": {
+			ops:  `[{"attributes":{"font":"Times New Roman, serif"},"insert":"times"},{"insert":"\n"}]`,
+			want: `<p><span style="font-family:'Times New Roman',serif;">times</span></p>`,
+		},
+		"injection": {
+			ops:  `[{"attributes":{"font":"serif;background:url(https://x.com/track)"},"insert":"text"},{"insert":"\n"}]`,
+			want: `<p>text</p>`,
+		},
+	}
+
+	for k, tc := range cases {
+		t.Run(k, func(t *testing.T) {
+			got, err := RenderWithOptions([]byte(tc.ops), RenderOptions{InlineFonts: true})
+			if err != nil {
+				t.Fatalf("%s", err)
+			}
+			if string(got) != tc.want {
+				t.Errorf("bad rendering; got: %s", got)
+			}
+		})
+	}
+
+}
+
+func TestRenderOptions_SelfClosing(t *testing.T) {
+
+	ops := []byte(`[{"insert":"a\n\n"},{"insert":{"image":"cat.jpg"}},{"insert":"\n"},{"insert":{"divider":true}},{"insert":"\nb\n"}]`)
+
+	cases := []struct {
+		selfClosing map[string]bool
+		want        string
+	}{
+		{nil, `<p>a</p><p><br></p><p><img src="cat.jpg"></p><hr><p>b</p>`},
+		{map[string]bool{"br": true}, `<p>a</p><p><br/></p><p><img src="cat.jpg"></p><hr><p>b</p>`},
+		{map[string]bool{"img": true, "hr": true}, `<p>a</p><p><br></p><p><img src="cat.jpg"/></p><hr/><p>b</p>`},
+		{map[string]bool{"br": true, "img": false, "hr": true}, `<p>a</p><p><br/></p><p><img src="cat.jpg"></p><hr/><p>b</p>`},
+	}
+
+	for i, tc := range cases {
+		got, err := RenderWithOptions(ops, RenderOptions{SelfClosing: tc.selfClosing})
+		if err != nil {
+			t.Fatalf("(index %d) %s", i, err)
+		}
+		if string(got) != tc.want {
+			t.Errorf("(index %d) bad rendering; got: %s", i, got)
+		}
+	}
+
+}
+
+func TestRenderOptions_VoidStyle(t *testing.T) {
+
+	ops := []byte(`[{"insert":"a\n\n"},{"insert":{"image":"cat.jpg"}},{"insert":"\n"},{"insert":{"divider":true}},{"insert":"\nb\n"}]`)
+
+	cases := []struct {
+		opts RenderOptions
+		want string
+	}{
+		{RenderOptions{}, `<p>a</p><p><br></p><p><img src="cat.jpg"></p><hr><p>b</p>`},
+		{RenderOptions{VoidStyle: HTML5}, `<p>a</p><p><br></p><p><img src="cat.jpg"></p><hr><p>b</p>`},
+		{RenderOptions{VoidStyle: XHTML}, `<p>a</p><p><br/></p><p><img src="cat.jpg"/></p><hr/><p>b</p>`},
+		{
+			RenderOptions{VoidStyle: XHTML, SelfClosing: map[string]bool{"hr": false}},
+			`<p>a</p><p><br/></p><p><img src="cat.jpg"/></p><hr><p>b</p>`,
+		},
+	}
+
+	for i, tc := range cases {
+		got, err := RenderWithOptions(ops, tc.opts)
+		if err != nil {
+			t.Fatalf("(index %d) %s", i, err)
+		}
+		if string(got) != tc.want {
+			t.Errorf("(index %d) bad rendering; got: %s", i, got)
+		}
+	}
+
+}
+
+func TestRenderOptions_IndentStyle(t *testing.T) {
+
+	ops := []byte(`[{"insert":"once"},{"attributes":{"indent":1},"insert":"\n"},{"insert":"item"},
+		{"attributes":{"indent":2,"list":"bullet"},"insert":"\n"}]`)
+
+	cases := []struct {
+		opts RenderOptions
+		want string
+	}{
+		{
+			RenderOptions{},
+			`<p class="ql-indent-1">once</p><ul><li class="ql-indent-2">item</li></ul>`,
+		},
+		{
+			RenderOptions{IndentStyle: true},
+			`<p style="padding-left:3em;">once</p><ul><li style="padding-left:6em;">item</li></ul>`,
+		},
+		{
+			RenderOptions{IndentStyle: true}.WithIndentUnit("px", 40),
+			`<p style="padding-left:40px;">once</p><ul><li style="padding-left:80px;">item</li></ul>`,
+		},
+		{
+			RenderOptions{IndentStyle: true}.WithIndentUnit("rem", 1.5),
+			`<p style="padding-left:1.5rem;">once</p><ul><li style="padding-left:3rem;">item</li></ul>`,
+		},
+	}
+
+	for i, tc := range cases {
+		got, err := RenderWithOptions(ops, tc.opts)
+		if err != nil {
+			t.Fatalf("(index %d) %s", i, err)
+		}
+		if string(got) != tc.want {
+			t.Errorf("(index %d) bad rendering; got: %s", i, got)
+		}
+	}
+
+	deep := []byte(`[{"insert":"deep"},{"attributes":{"indent":8,"list":"ordered"},"insert":"\n"}]`)
+	got, err := RenderWithOptions(deep, RenderOptions{IndentStyle: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `<ol><li style="padding-left:24em;">deep</li></ol>`; string(got) != want {
+		t.Errorf("bad rendering of deep indent; got: %s", got)
+	}
+
+	// The indent is set on the block element itself, not on a wrapper around it.
+	quote := []byte(`[{"insert":"Title"},{"attributes":{"header":3,"indent":1},"insert":"\n"},{"insert":"quote"},` +
+		`{"attributes":{"blockquote":true,"indent":2},"insert":"\n"}]`)
+	got, err = RenderWithOptions(quote, RenderOptions{IndentStyle: true, QuoteAttribution: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `<h3 style="padding-left:3em;">Title</h3><figure><blockquote style="padding-left:6em;">quote</blockquote></figure>`
+	if string(got) != want {
+		t.Errorf("bad rendering of indented header and quote; got: %s", got)
+	}
+
+	o := &Op{Type: "text", Data: "\n", Attrs: map[string]string{"list": "bullet", "indent": "8"}}
+	if lf, ok := o.getFormatter("list", new(RenderOptions)).(*listFormat); !ok || lf.indent != 8 {
+		t.Errorf("bad list indent depth; got formatter: %#v", lf)
+	}
+
+}
+
+func TestRenderOptions_BlockText(t *testing.T) {
+
+	ops := []byte(`[{"insert":"Tom & Jerry "},{"attributes":{"italic":true,"link":"https://x.com/tom"},"insert":"sing"},
+		{"attributes":{"header":2},"insert":"\n"},{"insert":"Plain <text>\n"},{"insert":"  code"},
+		{"attributes":{"code-block":true},"insert":"\n"},{"insert":"more  "},{"attributes":{"code-block":true},"insert":"\n"}]`)
+
+	var types []string
+	opts := RenderOptions{
+		BlockText: func(blockType, text string) string {
+			types = append(types, blockType)
+			switch blockType {
+			case "h1", "h2", "h3":
+				return strings.ToUpper(text)
+			case "pre":
+				return strings.TrimSpace(text)
+			}
+			return text
+		},
+	}
+
+	got, err := RenderWithOptions(ops, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `<h2>TOM &amp; JERRY <a href="https://x.com/tom" target="_blank"><em>SING</em></a></h2><p>Plain &lt;text&gt;</p>` +
+		`<pre class="ql-syntax">code` + "\nmore\n</pre>"
+	if string(got) != want {
+		t.Errorf("bad rendering; got: %s", got)
+	}
+
+	if wantTypes := "h2 h2 p pre pre"; strings.Join(types, " ") != wantTypes {
+		t.Errorf("wanted block types %q; got %q", wantTypes, types)
+	}
+
+}
+
+func TestRenderOptions_ListLabel(t *testing.T) {
+
+	ops := []byte(`[{"insert":"one"},{"attributes":{"list":"bullet"},"insert":"\n"},{"insert":"two"},
+		{"attributes":{"list":"bullet"},"insert":"\n"},{"insert":"first"},{"attributes":{"list":"ordered","aria-label":"Steps & notes"},"insert":"\n"}]`)
+
+	opts := RenderOptions{
+		ListLabel: func(o *Op) string {
+			return o.Attrs["list"] + " list"
+		},
+	}
+
+	got, err := RenderWithOptions(ops, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `<ul aria-label="bullet list"><li>one</li><li>two</li></ul><ol aria-label="Steps &amp; notes"><li>first</li></ol>`
+	if string(got) != want {
+		t.Errorf("bad rendering with option; got: %s", got)
+	}
+
+	got, err = Render(ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = `<ul><li>one</li><li>two</li></ul><ol aria-label="Steps &amp; notes"><li>first</li></ol>`
+	if string(got) != want {
+		t.Errorf("bad rendering without option; got: %s", got)
+	}
+
+}
+
+func TestRenderOptions_Filter(t *testing.T) {
+
+	ops := []byte(`[{"insert":"Published "},{"attributes":{"draft":true},"insert":"secret "},{"insert":"text\n"},
+		{"attributes":{"draft":true},"insert":"Draft line\n"},{"insert":"Last\n"}]`)
+
+	opts := RenderOptions{
+		Filter: func(o *Op) bool {
+			return !o.HasAttr("draft")
+		},
+	}
+
+	got, err := RenderWithOptions(ops, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "<p>Published text</p><p>Last</p>"; string(got) != want {
+		t.Errorf("bad rendering; got: %s", got)
+	}
+
+}
+
+func TestRenderOptions_TransformOp(t *testing.T) {
+
+	ops := []byte(`[{"insert":"Tom & Jerry "},{"attributes":{"bold":true},"insert":"<b>"},{"insert":"\n"},` +
+		`{"insert":{"image":"http://old.example.com/cat.png"}},{"attributes":{"header":2},"insert":"\n"}]`)
+
+	opts := RenderOptions{
+		TransformOp: func(o *Op) {
+			switch o.Type {
+			case "text":
+				o.Data = strings.ToUpper(o.Data)
+				if o.Data == "\n" && o.Attrs["header"] != "" {
+					o.Attrs["header"] = "3" // The formats follow changes to the attributes.
+				}
+			case "image":
+				o.Data = strings.Replace(o.Data, "http://old.example.com/", "https://cdn.example.com/", 1)
+			}
+		},
+	}
+
+	got, err := RenderWithOptions(ops, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `<p>TOM &amp; JERRY <strong>&lt;B&gt;</strong></p><h3><img src="https://cdn.example.com/cat.png"></h3>`
+	if string(got) != want {
+		t.Errorf("bad rendering; got: %s", got)
+	}
+
+}
+
+func TestRenderOptions_SiteOrigin(t *testing.T) {
+
+	cases := map[string]struct {
+		href string
+		want string
+	}{
+		"same origin": {
+			href: "https://Example.com/about",
+			want: `<a href="https://Example.com/about">`,
+		},
+		"relative": {
+			href: "/docs#intro",
+			want: `<a href="/docs#intro">`,
+		},
+		"cross origin": {
+			href: "https://widerwebs.com",
+			want: `<a href="https://widerwebs.com" target="_blank" rel="noopener">`,
+		},
+		"subdomain": {
+			href: "https://blog.example.com/post",
+			want: `<a href="https://blog.example.com/post" target="_blank" rel="noopener">`,
+		},
+	}
+
+	for k, tc := range cases {
+		t.Run(k, func(t *testing.T) {
+			ops := `[{"attributes":{"link":"` + tc.href + `"},"insert":"link"},{"insert":"\n"}]`
+			got, err := RenderWithOptions([]byte(ops), RenderOptions{SiteOrigin: "https://example.com"})
+			if err != nil {
+				t.Fatalf("%s", err)
+			}
+			if want := "<p>" + tc.want + "link</a></p>"; string(got) != want {
+				t.Errorf("bad rendering; got: %s", got)
+			}
+		})
+	}
+
+}
+
+func TestRenderOptions_MaxInlineDepth(t *testing.T) {
+
+	ops := []byte(`[{"attributes":{"bold":true},"insert":"a"},
+		{"attributes":{"bold":true,"italic":true,"underline":true,"strike":true,"script":"super","color":"red"},"insert":"b"},
+		{"attributes":{"bold":true,"italic":true},"insert":"c"},{"insert":"\n"}]`)
+
+	got, err := RenderWithOptions(ops, RenderOptions{MaxInlineDepth: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "<p><strong>a<em><s>b</s>c</em></strong></p>"; string(got) != want {
+		t.Errorf("bad rendering; got: %s", got)
+	}
+
+}
+
+func TestRenderOptions_HeaderIDs(t *testing.T) {
+
+	ops := []byte(`[{"insert":"Usage"},{"attributes":{"header":2},"insert":"\n"},{"insert":"Hello, World! (v2.0)"},` +
+		`{"attributes":{"header":2},"insert":"\n"},{"insert":"Usage"},{"attributes":{"header":2},"insert":"\n"},` +
+		`{"insert":"Usage-1"},{"attributes":{"header":3},"insert":"\n"},{"insert":"Usage"},{"attributes":{"header":2},"insert":"\n"},` +
+		`{"insert":"?!"},{"attributes":{"header":2},"insert":"\n"}]`)
+
+	cases := []struct {
+		opts RenderOptions
+		want string
+	}{
+		{
+			RenderOptions{HeaderIDs: true},
+			`<h2 id="usage">Usage</h2><h2 id="hello-world-v20">Hello, World! (v2.0)</h2><h2 id="usage-1">Usage</h2>` +
+				`<h3 id="usage-1-1">Usage-1</h3><h2 id="usage-2">Usage</h2><h2>?!</h2>`,
+		},
+		{
+			RenderOptions{HeaderIDs: true, HeaderSlug: func(text string) string {
+				return "h-" + strings.ToUpper(text[:1])
+			}},
+			`<h2 id="h-U">Usage</h2><h2 id="h-H">Hello, World! (v2.0)</h2><h2 id="h-U-1">Usage</h2>` +
+				`<h3 id="h-U-2">Usage-1</h3><h2 id="h-U-3">Usage</h2><h2 id="h-?">?!</h2>`,
+		},
+	}
+
+	for i, tc := range cases {
+		got, err := RenderWithOptions(ops, tc.opts)
+		if err != nil {
+			t.Fatalf("(index %d) %s", i, err)
+		}
+		if string(got) != tc.want {
+			t.Errorf("(index %d) bad rendering; got: %s", i, got)
+		}
+	}
+
+}
+
+func TestRenderOptions_HeaderAnchors(t *testing.T) {
+
+	ops := []byte(`[{"insert":"Getting "},{"attributes":{"bold":true},"insert":"Started"},{"attributes":{"header":1},"insert":"\n"},
+		{"insert":"text\nQ&A: What's new?"},{"attributes":{"header":2},"insert":"\n"}]`)
+
+	cases := []struct {
+		opts RenderOptions
+		want string
+	}{
+		{
+			RenderOptions{HeaderIDs: true},
+			`<h1 id="getting-started">Getting <strong>Started</strong></h1><p>text</p><h2 id="qa-whats-new">Q&amp;A: What&#39;s new?</h2>`,
+		},
+		{
+			RenderOptions{HeaderAnchors: true},
+			`<h1 id="getting-started"><a class="anchor" href="#getting-started"></a>Getting <strong>Started</strong></h1><p>text</p>` +
+				`<h2 id="qa-whats-new"><a class="anchor" href="#qa-whats-new"></a>Q&amp;A: What&#39;s new?</h2>`,
+		},
+		{
+			RenderOptions{HeaderAnchors: true, StripEmpty: true, HeaderAnchor: func(id string) string {
+				return `<a href="#` + id + `">#</a> `
+			}},
+			`<h1 id="getting-started"><a href="#getting-started">#</a> Getting <strong>Started</strong></h1><p>text</p>` +
+				`<h2 id="qa-whats-new"><a href="#qa-whats-new">#</a> Q&amp;A: What&#39;s new?</h2>`,
+		},
+	}
+
+	for i, tc := range cases {
+		got, err := RenderWithOptions(ops, tc.opts)
+		if err != nil {
+			t.Fatalf("(index %d) %s", i, err)
+		}
+		if string(got) != tc.want {
+			t.Errorf("(index %d) bad rendering; got: %s", i, got)
+		}
+	}
+
+}
+
+func TestRenderOptions_SectionBreak(t *testing.T) {
+
+	ops := []byte(`[{"insert":"Part one\n"},{"insert":{"section-break":true}},{"insert":"\nPart two\n"}]`)
+
+	got, err := RenderWithOptions(ops, RenderOptions{SectionBreak: `<hr class="fleuron">`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `<p>Part one</p><hr class="fleuron"><p>Part two</p>`; string(got) != want {
+		t.Errorf("bad rendering; got: %s", got)
+	}
+
+}
+
+func TestRenderOptions_MergeLists(t *testing.T) {
+
+	ops := []byte(`[{"insert":"a"},{"attributes":{"list":"bullet"},"insert":"\n"},{"insert":"\n"},{"insert":"b"},
+		{"attributes":{"list":"bullet"},"insert":"\n"},{"insert":"\n\n"},{"insert":"c"},{"attributes":{"list":"ordered"},"insert":"\n"},
+		{"insert":"\n"}]`)
+
+	cases := []struct {
+		opts RenderOptions
+		want string
+	}{
+		{
+			RenderOptions{},
+			"<ul><li>a</li></ul><p><br></p><ul><li>b</li></ul><p><br></p><p><br></p><ol><li>c</li></ol><p><br></p>",
+		},
+		{
+			RenderOptions{MergeLists: true},
+			"<ul><li>a</li><li>b</li></ul><p><br></p><p><br></p><ol><li>c</li></ol><p><br></p>",
+		},
+	}
+
+	for i, tc := range cases {
+		got, err := RenderWithOptions(ops, tc.opts)
+		if err != nil {
+			t.Fatalf("(index %d) %s", i, err)
+		}
+		if string(got) != tc.want {
+			t.Errorf("(index %d) bad rendering; got: %s", i, got)
+		}
+	}
+
+}
+
+// lineHeightFormat is a custom block format setting the line height.
+type lineHeightFormat string
+
+func (bf lineHeightFormat) Fmt() *Format {
+	return &Format{
+		Val:   string(bf),
+		Place: Style,
+		Block: true,
+	}
+}
+
+func (bf lineHeightFormat) HasFormat(o *Op) bool {
+	return o.Attrs["line-height"] != ""
+}
+
+func TestRenderOptions_StyleFirst(t *testing.T) {
+
+	ops := []byte(`[{"insert":"text"},{"attributes":{"align":"center","indent":1,"line-height":"2"},"insert":"\n"}]`)
+
+	customFormats := func(keyword string, o *Op) Formatter {
+		if keyword == "line-height" {
+			return lineHeightFormat("line-height:" + o.Attrs["line-height"] + ";")
+		}
+		return nil
+	}
+
+	cases := []struct {
+		opts RenderOptions
+		want []string // either order of the classes, which come from the map of attributes
+	}{
+		{
+			RenderOptions{CustomFormats: customFormats},
+			[]string{
+				`<p class="ql-align-center ql-indent-1" style="line-height:2;">text</p>`,
+				`<p class="ql-indent-1 ql-align-center" style="line-height:2;">text</p>`,
+			},
+		},
+		{
+			RenderOptions{CustomFormats: customFormats, StyleFirst: true},
+			[]string{
+				`<p style="line-height:2;" class="ql-align-center ql-indent-1">text</p>`,
+				`<p style="line-height:2;" class="ql-indent-1 ql-align-center">text</p>`,
+			},
+		},
+	}
+
+	for i, tc := range cases {
+		got, err := RenderWithOptions(ops, tc.opts)
+		if err != nil {
+			t.Fatalf("(index %d) %s", i, err)
+		}
+		if string(got) != tc.want[0] && string(got) != tc.want[1] {
+			t.Errorf("(index %d) bad rendering; got: %s", i, got)
+		}
+	}
+
+}
+
+func TestRenderOptions_WithSanitizer(t *testing.T) {
+
+	ops := []byte(`[{"insert":"text "},{"attributes":{"bold":true},"insert":"bold"},{"insert":"\n"}]`)
+
+	// A stub sanitizer that strips the bold tags.
+	stripBold := func(html []byte) []byte {
+		html = bytes.ReplaceAll(html, []byte("<strong>"), nil)
+		return bytes.ReplaceAll(html, []byte("</strong>"), nil)
+	}
+
+	got, err := RenderWithOptions(ops, RenderOptions{}.WithSanitizer(stripBold))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "<p>text bold</p>"; string(got) != want {
+		t.Errorf("bad rendering; wanted %s; got: %s", want, got)
+	}
+
+	got, err = RenderWithOptions(ops, RenderOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "<p>text <strong>bold</strong></p>"; string(got) != want {
+		t.Errorf("bad rendering without a sanitizer; wanted %s; got: %s", want, got)
+	}
+
+}
+
+func TestRenderOptions_CodeLanguageLabel(t *testing.T) {
+
+	ops := []byte(`[{"insert":"let a = 1;"},{"attributes":{"code-block":"javascript"},"insert":"\n"},{"insert":"a++;"},` +
+		`{"attributes":{"code-block":"javascript"},"insert":"\n"},{"insert":"text"},{"insert":"\n"},` +
+		`{"insert":"b = 1"},{"attributes":{"code-block":"<b>"},"insert":"\n"},{"insert":"plain"},{"attributes":{"code-block":true},"insert":"\n"}]`)
+
+	cases := []struct {
+		opts RenderOptions
+		want string
+	}{
+		{
+			RenderOptions{},
+			`<pre class="ql-syntax"><code class="language-javascript">let a = 1;` + "\na++;\n</code></pre><p>text</p>" +
+				`<pre class="ql-syntax"><code class="language-&lt;b&gt;">b = 1` + "\n</code></pre>" + `<pre class="ql-syntax">plain` + "\n</pre>",
+		},
+		{
+			RenderOptions{CodeLanguageLabel: true},
+			`<div class="code-lang">javascript</div><pre class="ql-syntax"><code class="language-javascript">let a = 1;` +
+				"\na++;\n</code></pre><p>text</p>" +
+				`<div class="code-lang">&lt;b&gt;</div><pre class="ql-syntax"><code class="language-&lt;b&gt;">b = 1` + "\n</code></pre>" +
+				`<pre class="ql-syntax">plain` + "\n</pre>",
+		},
+	}
+
+	for i, tc := range cases {
+		got, err := RenderWithOptions(ops, tc.opts)
+		if err != nil {
+			t.Fatalf("(index %d) %s", i, err)
+		}
+		if string(got) != tc.want {
+			t.Errorf("(index %d) bad rendering; wanted: %q; got: %q", i, tc.want, got)
+		}
+	}
+
+}
+
+func TestRenderOptions_DebugOpIndex(t *testing.T) {
+
+	ops := []byte(`[{"insert":"Title"},{"attributes":{"header":1},"insert":"\n"},{"insert":"one "},` +
+		`{"attributes":{"italic":true},"insert":"two"},{"insert":"\nthree\n"},{"insert":"item"},{"attributes":{"list":"bullet"},"insert":"\n"}]`)
+
+	got, err := RenderWithOptions(ops, RenderOptions{DebugOpIndex: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `<h1 data-op-index="1">Title</h1><p data-op-index="4">one <em>two</em></p><p data-op-index="4">three</p>` +
+		`<ul><li data-op-index="6">item</li></ul>`
+	if string(got) != want {
+		t.Errorf("bad rendering; wanted: %s; got: %s", want, got)
+	}
+
+	got, err = RenderWithOptions(ops, RenderOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(got, []byte("data-op-index")) {
+		t.Errorf("op indexes written by default: %s", got)
+	}
+
+}
+
+func TestRenderOptions_MaxImageSize(t *testing.T) {
+
+	image := func(width, height string) []byte {
+		return []byte(`[{"insert":{"image":"a.png"},"attributes":{"width":"` + width + `","height":"` + height + `"}},{"insert":"\n"}]`)
+	}
+
+	opts := RenderOptions{MaxImageWidth: 800, MaxImageHeight: 600}
+
+	cases := []struct {
+		ops  []byte
+		opts RenderOptions
+		want string
+	}{
+		{image("640", "480"), opts, `<p><img src="a.png" width="640" height="480"></p>`},              // within the limits
+		{image("800px", "600px"), opts, `<p><img src="a.png" width="800" height="600"></p>`},          // at the limits
+		{image("1000", "500"), opts, `<p><img src="a.png" width="800" height="400"></p>`},             // too wide
+		{image("1000", "999"), opts, `<p><img src="a.png" width="601" height="600"></p>`},             // too wide and then too tall
+		{image("300", "1200"), opts, `<p><img src="a.png" width="150" height="600"></p>`},             // too tall
+		{image("2000", ""), opts, `<p><img src="a.png" width="800"></p>`},                             // only a width
+		{image("wide", "-5"), opts, `<p><img src="a.png"></p>`},                                       // invalid
+		{image("1000", "500"), RenderOptions{}, `<p><img src="a.png" width="1000" height="500"></p>`}, // no limits
+	}
+
+	for i, tc := range cases {
+		got, err := RenderWithOptions(tc.ops, tc.opts)
+		if err != nil {
+			t.Fatalf("(index %d) %s", i, err)
+		}
+		if string(got) != tc.want {
+			t.Errorf("(index %d) bad rendering; wanted: %s; got: %s", i, tc.want, got)
+		}
+	}
+
+}
+
+func TestRenderOptions_AllowedSchemes(t *testing.T) {
+
+	link := func(href string) []byte {
+		return []byte(`[{"insert":"x","attributes":{"link":` + strconv.Quote(href) + `}},{"insert":"\n"}]`)
+	}
+	image := func(src string) []byte {
+		return []byte(`[{"insert":"a"},{"insert":{"image":` + strconv.Quote(src) + `}},{"insert":"\n"}]`)
+	}
+
+	cases := []struct {
+		ops  []byte
+		opts RenderOptions
+		want string
+	}{
+		{link("https://example.com/?q=1"), RenderOptions{}, `<p><a href="https://example.com/?q=1" target="_blank">x</a></p>`},
+		{link("/about#team"), RenderOptions{}, `<p><a href="/about#team" target="_blank">x</a></p>`},
+		{link("MailTo:me@example.com"), RenderOptions{}, `<p><a href="MailTo:me@example.com" target="_blank">x</a></p>`},
+		{link("javascript:alert(1)"), RenderOptions{}, `<p>x</p>`},
+		{link(" JavaScript:alert(1)"), RenderOptions{}, `<p>x</p>`},
+		{link("java\tscript:alert(1)"), RenderOptions{}, `<p>x</p>`},
+		{link("data:text/html;base64,PHNjcmlwdD4="), RenderOptions{}, `<p>x</p>`},
+		{link("http://example.com"), RenderOptions{AllowedSchemes: []string{"https"}}, `<p>x</p>`},
+		{image("https://example.com/a.png"), RenderOptions{}, `<p>a<img src="https://example.com/a.png"></p>`},
+		{image("img/a.png"), RenderOptions{}, `<p>a<img src="img/a.png"></p>`},
+		{image("javascript:alert(1)"), RenderOptions{}, `<p>a</p>`},
+		{image("data:image/png;base64,iVBO"), RenderOptions{}, `<p>a<img src="data:image/png;base64,iVBO"></p>`},
+		{image("data:text/html;base64,PHNjcmlwdD4="), RenderOptions{}, `<p>a</p>`},
+		{image("data:text/html;base64,PHNjcmlwdD4="), RenderOptions{AllowedSchemes: []string{"data"}}, `<p>a<img src="data:text/html;base64,PHNjcmlwdD4="></p>`},
+	}
+
+	for i, tc := range cases {
+		got, err := RenderWithOptions(tc.ops, tc.opts)
+		if err != nil {
+			t.Fatalf("(index %d) %s", i, err)
+		}
+		if string(got) != tc.want {
+			t.Errorf("(index %d) bad rendering; wanted: %s; got: %s", i, tc.want, got)
+		}
+	}
+
+	_, warnings, err := RenderWithWarnings(link("javascript:alert(1)"), RenderOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []Warning{{Op: 0, Message: `link "javascript:alert(1)" is not allowed`}}; !reflect.DeepEqual(warnings, want) {
+		t.Errorf("bad warnings; got %v", warnings)
+	}
+
+}
+
+func TestRenderOptions_ClassPrefix(t *testing.T) {
+
+	ops := []byte(`[{"insert":"big","attributes":{"size":"large"}},{"insert":" "},{"insert":"code","attributes":{"font":"monospace"}},{"insert":"\n","attributes":{"align":"center"}}]`)
+
+	cases := []struct {
+		opts RenderOptions
+		want string
+	}{
+		{RenderOptions{}, `<p class="ql-align-center"><span class="ql-size-large">big</span> <span class="ql-font-monospace">code</span></p>`},
+		{RenderOptions{ClassPrefix: "doc-"}, `<p class="doc-align-center"><span class="doc-size-large">big</span> <span class="doc-font-monospace">code</span></p>`},
+	}
+
+	for i, tc := range cases {
+		got, err := RenderWithOptions(ops, tc.opts)
+		if err != nil {
+			t.Fatalf("(index %d) %s", i, err)
+		}
+		if string(got) != tc.want {
+			t.Errorf("(index %d) bad rendering; wanted: %s; got: %s", i, tc.want, got)
+		}
+	}
+
+}
+
+func TestRenderOptions_LinkTarget(t *testing.T) {
+
+	ops := []byte(`[{"insert":"out","attributes":{"link":"https://other.com/"}},{"insert":" "},` +
+		`{"insert":"in","attributes":{"link":"/about"}},{"insert":"\n"}]`)
+
+	cases := []struct {
+		opts RenderOptions
+		want string
+	}{
+		{
+			RenderOptions{},
+			`<p><a href="https://other.com/" target="_blank">out</a> <a href="/about" target="_blank">in</a></p>`,
+		},
+		{
+			RenderOptions{LinkTarget: "_top"},
+			`<p><a href="https://other.com/" target="_top">out</a> <a href="/about" target="_top">in</a></p>`,
+		},
+		{
+			RenderOptions{LinkTarget: "_top", SiteOrigin: "https://example.com"},
+			`<p><a href="https://other.com/" target="_top">out</a> <a href="/about">in</a></p>`,
+		},
+		{
+			RenderOptions{SiteOrigin: "https://example.com"},
+			`<p><a href="https://other.com/" target="_blank" rel="noopener">out</a> <a href="/about">in</a></p>`,
+		},
+	}
+
+	for i, tc := range cases {
+		got, err := RenderWithOptions(ops, tc.opts)
+		if err != nil {
+			t.Fatalf("(index %d) %s", i, err)
+		}
+		if string(got) != tc.want {
+			t.Errorf("(index %d) bad rendering; wanted: %s; got: %s", i, tc.want, got)
+		}
+	}
+
+}
+
+func TestRenderOptions_AllowedSchemes_dataImages(t *testing.T) {
+
+	// A 1x1 PNG followed by a long run of padding to make a source of over a megabyte.
+	png := "iVBORw0KGgoAAAANSUhEUgAAAAEAAAABCAYAAAAfFcSJAAAADUlEQVR42mNk+M9QDwADhgGAWjR9awAAAABJRU5ErkJggg=="
+	long := "data:image/png;base64," + png + strings.Repeat("QUFB", 1<<18)
+
+	cases := []struct {
+		src     string
+		allowed bool
+	}{
+		{"data:image/png;base64," + png, true},
+		{"DATA:Image/PNG;base64," + png, true},
+		{"data:image/jpeg,rawdata", true},
+		{long, true},
+		{"data:image/svg+xml;base64,PHN2Zz48c2NyaXB0Lz48L3N2Zz4=", false},
+		{"data:text/html;base64,PHNjcmlwdD4=", false},
+		{"data:;base64," + png, false},
+	}
+
+	for i, tc := range cases {
+		ops := []byte(`[{"insert":{"image":` + strconv.Quote(tc.src) + `}},{"insert":"\n"}]`)
+		got, err := RenderWithOptions(ops, RenderOptions{})
+		if err != nil {
+			t.Fatalf("(index %d) %s", i, err)
+		}
+		want := "<p><br></p>"
+		if tc.allowed {
+			want = `<p><img src="` + tc.src + `"></p>`
+		}
+		if string(got) != want {
+			t.Errorf("(index %d) bad rendering; got %d bytes: %.100s", i, len(got), got)
+		}
+	}
+
+}
+
+func TestRenderOptions_InlineStyles(t *testing.T) {
+
+	ops := []byte(`[{"insert":"big","attributes":{"size":"large"}},{"insert":" "},{"insert":"odd","attributes":{"size":"odd"}},` +
+		`{"attributes":{"align":"center"},"insert":"\n"},{"insert":"x"},{"attributes":{"align":"up"},"insert":"\n"}]`)
+
+	cases := []struct {
+		opts RenderOptions
+		want string
+	}{
+		{
+			RenderOptions{},
+			`<p class="ql-align-center"><span class="ql-size-large">big</span> <span class="ql-size-odd">odd</span></p>` +
+				`<p class="ql-align-up">x</p>`,
+		},
+		{
+			RenderOptions{InlineStyles: true},
+			`<p style="text-align:center;"><span style="font-size:1.5em;">big</span> <span class="ql-size-odd">odd</span></p>` +
+				`<p class="ql-align-up">x</p>`,
+		},
+	}
+
+	for i, tc := range cases {
+		got, err := RenderWithOptions(ops, tc.opts)
+		if err != nil {
+			t.Fatalf("(index %d) %s", i, err)
+		}
+		if string(got) != tc.want {
+			t.Errorf("(index %d) bad rendering; wanted: %s; got: %s", i, tc.want, got)
+		}
+	}
+
+}
+
+func TestRenderOptions_PreserveUnknownAttrs(t *testing.T) {
+
+	ops := []byte(`[{"insert":"a","attributes":{"foo":"bar"}},{"insert":"b","attributes":{"foo":"bar","bold":true}},{"insert":"c"},` +
+		`{"insert":"\n","attributes":{"foo":"x\"y","align":"center","Bad":"1","note":"n"}}]`)
+
+	cases := []struct {
+		opts RenderOptions
+		want string
+	}{
+		{RenderOptions{}, `<p class="ql-align-center">a<strong>b</strong>c</p>`},
+		{
+			RenderOptions{PreserveUnknownAttrs: true},
+			`<p class="ql-align-center" data-foo="x&#34;y" data-note="n"><span data-foo="bar">a<strong>b</strong></span>c</p>`,
+		},
+	}
+
+	for i, tc := range cases {
+		got, err := RenderWithOptions(ops, tc.opts)
+		if err != nil {
+			t.Fatalf("(index %d) %s", i, err)
+		}
+		if string(got) != tc.want {
+			t.Errorf("(index %d) bad rendering; got: %s", i, got)
+		}
+	}
+
+}
+
+func TestRenderOptions_UnwrapParagraphs(t *testing.T) {
+
+	cases := []struct {
+		ops           string
+		wrapped, want string
+	}{
+		{`[{"insert":"hello\n"}]`, `<p>hello</p>`, `hello`},
+		{`[{"insert":"hello\n"},{"insert":"world","attributes":{"bold":true}},{"insert":"\n"}]`, `<p>hello</p><p><strong>world</strong></p>`, `hello<br><strong>world</strong>`},
+		{`[{"insert":"one\n\nthree\n"}]`, `<p>one</p><p><br></p><p>three</p>`, `one<br><br>three`},
+		{
+			`[{"insert":"Title"},{"insert":"\n","attributes":{"header":1}},{"insert":"one\ntwo"},{"insert":"\n","attributes":{"align":"center"}},{"insert":"three\n"}]`,
+			`<h1>Title</h1><p>one</p><p class="ql-align-center">two</p><p>three</p>`,
+			`<h1>Title</h1>one<p class="ql-align-center">two</p>three`,
+		},
+	}
+
+	for i, tc := range cases {
+		for _, unwrap := range []bool{false, true} {
+			got, err := RenderWithOptions([]byte(tc.ops), RenderOptions{UnwrapParagraphs: unwrap})
+			if err != nil {
+				t.Fatalf("(index %d) %s", i, err)
+			}
+			want := tc.wrapped
+			if unwrap {
+				want = tc.want
+			}
+			if string(got) != want {
+				t.Errorf("(index %d, unwrapped %v) bad rendering; got: %s", i, unwrap, got)
+			}
+		}
+	}
+
+}
+
+func TestRenderOptions_ParagraphTag(t *testing.T) {
+
+	ops := []byte(`[{"insert":"one\n\n"},{"insert":{"image":"cat.png"}},{"insert":"\n"},{"insert":"Title"},` +
+		`{"insert":"\n","attributes":{"header":2}},{"insert":"two"},{"insert":"\n","attributes":{"align":"right"}}]`)
+
+	cases := []struct {
+		opts RenderOptions
+		want string
+	}{
+		{RenderOptions{}, `<p>one</p><p><br></p><p><img src="cat.png"></p><h2>Title</h2><p class="ql-align-right">two</p>`},
+		{RenderOptions{ParagraphTag: "div"}, `<div>one</div><div><br></div><div><img src="cat.png"></div><h2>Title</h2><div class="ql-align-right">two</div>`},
+		{
+			RenderOptions{ParagraphTag: "div", EmptyParagraph: EmptyNbsp},
+			`<div>one</div><div>&nbsp;</div><div><img src="cat.png"></div><h2>Title</h2><div class="ql-align-right">two</div>`,
+		},
+	}
+
+	for i, tc := range cases {
+		got, err := RenderWithOptions(ops, tc.opts)
+		if err != nil {
+			t.Fatalf("(index %d) %s", i, err)
+		}
+		if string(got) != tc.want {
+			t.Errorf("(index %d) bad rendering; got: %s", i, got)
+		}
+	}
+
+}
+
+func TestRenderOptions_SemanticTags(t *testing.T) {
+
+	ops := []byte(`[{"insert":"old","attributes":{"strike":true,"bold":true}},{"insert":" new","attributes":{"underline":true,"bold":true}},` +
+		`{"insert":" both","attributes":{"underline":true,"strike":true}},{"insert":"\n"}]`)
+
+	cases := []struct {
+		opts RenderOptions
+		want string
+	}{
+		{RenderOptions{}, `<p><s><strong>old</strong></s><strong><u> new</u></strong><u><s> both</s></u></p>`},
+		{RenderOptions{SemanticTags: true}, `<p><del><strong>old</strong></del><strong><ins> new</ins></strong><ins><del> both</del></ins></p>`},
+	}
+
+	for i, tc := range cases {
+		got, err := RenderWithOptions(ops, tc.opts)
+		if err != nil {
+			t.Fatalf("(index %d) %s", i, err)
+		}
+		if string(got) != tc.want {
+			t.Errorf("(index %d) bad rendering; got: %s", i, got)
+		}
+	}
+
+}
+
+func TestRenderOptions_PreserveWhitespace(t *testing.T) {
+
+	ops := []byte(`[{"insert":"plain text\n\tindented\nwide  gap\n  "},{"insert":"lead","attributes":{"bold":true}},` +
+		`{"insert":"\n","attributes":{"align":"center"}},{"insert":"  code"},{"insert":"\n","attributes":{"code-block":true}}]`)
+
+	cases := []struct {
+		opts RenderOptions
+		want string
+	}{
+		{
+			RenderOptions{},
+			"<p>plain text</p><p>\tindented</p><p>wide  gap</p><p class=\"ql-align-center\">  <strong>lead</strong></p>" +
+				`<pre class="ql-syntax">  code` + "\n</pre>",
+		},
+		{
+			RenderOptions{PreserveWhitespace: true},
+			"<p>plain text</p><p style=\"white-space:pre-wrap;\">\tindented</p><p style=\"white-space:pre-wrap;\">wide  gap</p>" +
+				`<p class="ql-align-center" style="white-space:pre-wrap;">  <strong>lead</strong></p><pre class="ql-syntax">  code` + "\n</pre>",
+		},
+	}
+
+	for i, tc := range cases {
+		got, err := RenderWithOptions(ops, tc.opts)
+		if err != nil {
+			t.Fatalf("(index %d) %s", i, err)
+		}
+		if string(got) != tc.want {
+			t.Errorf("(index %d) bad rendering; got: %s", i, got)
+		}
+	}
+
+}
+
+func TestRenderOptions_SkipInvalidOps(t *testing.T) {
+
+	ops := []byte(`[{"insert":"first\n"},{"insert":null},{"insert":{"sparkle":"gold"}},{"insert":"last\n"}]`)
+
+	// By default, the first invalid op stops the rendering.
+	got, err := Render(ops)
+	if re, ok := err.(*RenderError); !ok || re.OpIndex != 1 {
+		t.Fatalf("expected a RenderError for op 1; got: %v", err)
+	}
+	if want := `<p>first</p>`; string(got) != want {
+		t.Errorf("bad rendering before the error; got: %s", got)
+	}
+
+	html, warnings, err := RenderWithWarnings(ops, RenderOptions{SkipInvalidOps: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `<p>first</p><p>last</p>`; string(html) != want {
+		t.Errorf("bad rendering with invalid ops skipped; got: %s", html)
+	}
+
+	want := []Warning{
+		{Op: 1, Message: "skipped because it lacks an insert"},
+		{Op: 2, Message: "skipped because it does not have a format defined for its type"},
+	}
+	if !reflect.DeepEqual(warnings, want) {
+		t.Errorf("bad warnings; got %v", warnings)
+	}
+
+}
+
+func TestRenderOptions_TrimTrailingEmpty(t *testing.T) {
+
+	cases := []struct {
+		ops  string
+		opts RenderOptions
+		want string
+	}{
+		{`[{"insert":"text\n\n"}]`, RenderOptions{}, `<p>text</p><p><br></p>`},
+		{`[{"insert":"text\n\n"}]`, RenderOptions{TrimTrailingEmpty: true}, `<p>text</p>`},
+		{`[{"insert":"text\n\n\n"}]`, RenderOptions{TrimTrailingEmpty: true}, `<p>text</p><p><br></p>`},
+		{`[{"insert":"one\n\ntwo\n"}]`, RenderOptions{TrimTrailingEmpty: true}, `<p>one</p><p><br></p><p>two</p>`},
+		{`[{"insert":"\n"}]`, RenderOptions{TrimTrailingEmpty: true}, ``},
+		{
+			`[{"insert":"item"},{"insert":"\n","attributes":{"list":"bullet"}},{"insert":"\n"}]`,
+			RenderOptions{TrimTrailingEmpty: true},
+			`<ul><li>item</li></ul>`,
+		},
+		{
+			`[{"insert":"one\n\ntwo\n\n"}]`,
+			RenderOptions{TrimTrailingEmpty: true, UnwrapParagraphs: true},
+			`one<br><br>two`,
+		},
+	}
+
+	for i, tc := range cases {
+		got, err := RenderWithOptions([]byte(tc.ops), tc.opts)
+		if err != nil {
+			t.Fatalf("(index %d) %s", i, err)
+		}
+		if string(got) != tc.want {
+			t.Errorf("(index %d) bad rendering; got: %s", i, got)
+		}
+	}
+
+}
+
+func TestRenderOptions_Escaping(t *testing.T) {
+
+	ops := []byte(`[{"insert":"<café> & \"tea\"\n"}]`)
+
+	cases := []struct {
+		esc  Escaping
+		want string
+	}{
+		{EscapeNamed, `<p>&lt;café&gt; &amp; &#34;tea&#34;</p>`},
+		{EscapeNumeric, `<p>&#60;café&#62; &#38; &#34;tea&#34;</p>`},
+		{EscapeASCII, `<p>&lt;caf&#233;&gt; &amp; &#34;tea&#34;</p>`},
+	}
+
+	for i, tc := range cases {
+		got, err := RenderWithOptions(ops, RenderOptions{Escaping: tc.esc})
+		if err != nil {
+			t.Fatalf("(index %d) %s", i, err)
+		}
+		if string(got) != tc.want {
+			t.Errorf("(index %d) bad rendering; got: %s", i, got)
+		}
+	}
+
+	// Text transformed by BlockText is escaped the same way.
+	opts := RenderOptions{
+		Escaping: EscapeNumeric,
+		BlockText: func(_, text string) string {
+			return strings.ToUpper(text)
+		},
+	}
+	got, err := RenderWithOptions(ops, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `<p>&#60;CAFÉ&#62; &#38; &#34;TEA&#34;</p>`; string(got) != want {
+		t.Errorf("bad rendering with BlockText; got: %s", got)
+	}
+
+}
+
+func TestRenderOptions_Escaping_embeds(t *testing.T) {
+
+	ops := map[string]string{
+		"footnote-ref": `[{"insert":{"footnote-ref":"é<"}},{"insert":"\n"}]`,
+		"mention":      `[{"insert":{"mention":{"id":"1","value":"é<","denotationChar":"@"}}},{"insert":"\n"}]`,
+		"formula":      `[{"insert":{"formula":"é<"}},{"insert":"\n"}]`,
+		"code-block":   `[{"insert":"x"},{"attributes":{"code-block":"é< b"},"insert":"\n"}]`,
+	}
+
+	cases := []struct {
+		embed string
+		esc   Escaping
+		want  string
+	}{
+		{"footnote-ref", EscapeNamed, `<p><sup class="footnote-ref"><a href="#fn-é&lt;" id="fnref-é&lt;">é&lt;</a></sup></p>`},
+		{"footnote-ref", EscapeNumeric, `<p><sup class="footnote-ref"><a href="#fn-é&lt;" id="fnref-é&lt;">é&#60;</a></sup></p>`},
+		{"footnote-ref", EscapeASCII, `<p><sup class="footnote-ref"><a href="#fn-é&lt;" id="fnref-é&lt;">&#233;&lt;</a></sup></p>`},
+		{"mention", EscapeNamed, `<p><span class="mention" data-id="1">@é&lt;</span></p>`},
+		{"mention", EscapeNumeric, `<p><span class="mention" data-id="1">@é&#60;</span></p>`},
+		{"mention", EscapeASCII, `<p><span class="mention" data-id="1">@&#233;&lt;</span></p>`},
+		{"formula", EscapeNamed, `<p><span class="ql-formula" data-value="é&lt;">é&lt;</span></p>`},
+		{"formula", EscapeNumeric, `<p><span class="ql-formula" data-value="é&lt;">é&#60;</span></p>`},
+		{"formula", EscapeASCII, `<p><span class="ql-formula" data-value="é&lt;">&#233;&lt;</span></p>`},
+		{"code-block", EscapeNamed, `<div class="code-lang">é&lt; b</div><pre class="ql-syntax"><code class="language-é&lt;-b">x` + "\n</code></pre>"},
+		{"code-block", EscapeNumeric, `<div class="code-lang">é&#60; b</div><pre class="ql-syntax"><code class="language-é&#60;-b">x` + "\n</code></pre>"},
+		{"code-block", EscapeASCII, `<div class="code-lang">&#233;&lt; b</div><pre class="ql-syntax"><code class="language-&#233;&lt;-b">x` + "\n</code></pre>"},
+	}
+
+	for i, tc := range cases {
+		got, err := RenderWithOptions([]byte(ops[tc.embed]), RenderOptions{Escaping: tc.esc, CodeLanguageLabel: true})
+		if err != nil {
+			t.Fatalf("(index %d) %s", i, err)
+		}
+		if string(got) != tc.want {
+			t.Errorf("(index %d) bad rendering of %s; wanted: %q; got: %q", i, tc.embed, tc.want, got)
+		}
+	}
+
+}
+
+func TestRenderOptions_LazyImages(t *testing.T) {
+
+	ops := []byte(`[{"insert":{"image":"cat.png"},"attributes":{"alt":"A cat","width":"300"}},{"insert":"\n"}]`)
+
+	cases := []struct {
+		opts RenderOptions
+		want string
+	}{
+		{RenderOptions{}, `<p><img src="cat.png" alt="A cat" width="300"></p>`},
+		{RenderOptions{LazyImages: true}, `<p><img src="cat.png" alt="A cat" width="300" loading="lazy" decoding="async"></p>`},
+		{
+			RenderOptions{LazyImages: true, VoidStyle: XHTML},
+			`<p><img src="cat.png" alt="A cat" width="300" loading="lazy" decoding="async"/></p>`,
+		},
+	}
+
+	for i, tc := range cases {
+		got, err := RenderWithOptions(ops, tc.opts)
+		if err != nil {
+			t.Fatalf("(index %d) %s", i, err)
+		}
+		if string(got) != tc.want {
+			t.Errorf("(index %d) bad rendering; got: %s", i, got)
+		}
+	}
+
+}
+
+func TestRenderOptions_AutoLink(t *testing.T) {
+
+	cases := []struct {
+		ops  string
+		want string
+	}{
+		{
+			`[{"insert":"See https://example.com/a?b=1&c=2. It's good\n"}]`,
+			`<p>See <a href="https://example.com/a?b=1&amp;c=2" target="_blank">https://example.com/a?b=1&amp;c=2</a>. It&#39;s good</p>`,
+		},
+		{
+			`[{"insert":"http://x.org/wiki/Go_(lang)"},{"insert":" (https://y.org)\n"}]`,
+			`<p><a href="http://x.org/wiki/Go_(lang)" target="_blank">http://x.org/wiki/Go_(lang)</a> ` +
+				`(<a href="https://y.org" target="_blank">https://y.org</a>)</p>`,
+		},
+		{
+			`[{"insert":"https://example.com","attributes":{"link":"https://example.com"}},{"insert":"\n"}]`,
+			`<p><a href="https://example.com" target="_blank">https://example.com</a></p>`,
+		},
+		{
+			`[{"insert":"no https:// or xhttp://links "},{"insert":"http://a.com","attributes":{"code":true}},{"insert":"\n"}]`,
+			`<p>no https:// or xhttp://links <code>http://a.com</code></p>`,
+		},
+		{
+			`[{"insert":"http://a.com"},{"insert":"\n","attributes":{"code-block":true}}]`,
+			"<pre class=\"ql-syntax\">http://a.com\n</pre>",
+		},
+		{
+			`[{"insert":"see http://a.com/x"},{"insert":"yz","attributes":{"bold":true}},{"insert":" or http://b.com"},` +
+				`{"insert":" now","attributes":{"italic":true}},{"insert":"\n"}]`,
+			`<p>see http://a.com/x<strong>yz</strong> or <a href="http://b.com" target="_blank">http://b.com</a><em> now</em></p>`,
+		},
+		{
+			`[{"insert":"http://a.com"},{"insert":{"break":true}},{"insert":"next\n"}]`,
+			`<p><a href="http://a.com" target="_blank">http://a.com</a><br>next</p>`,
+		},
+	}
+
+	for i, tc := range cases {
+		got, err := RenderWithOptions([]byte(tc.ops), RenderOptions{AutoLink: true})
+		if err != nil {
+			t.Fatalf("(index %d) %s", i, err)
+		}
+		if string(got) != tc.want {
+			t.Errorf("(index %d) bad rendering; got: %s", i, got)
+		}
+	}
+
+}
+
+func TestRenderOptions_RootClass(t *testing.T) {
+
+	ops := []byte(`[{"insert":"text"},{"insert":"\n","attributes":{"align":"center"}}]`)
+
+	cases := []struct {
+		ops  []byte
+		opts RenderOptions
+		want string
+	}{
+		{ops, RenderOptions{}, `<p class="ql-align-center">text</p>`},
+		{ops, RenderOptions{RootClass: "ql-editor"}, `<div class="ql-editor"><p class="ql-align-center">text</p></div>`},
+		{[]byte(`[]`), RenderOptions{RootClass: "ql-editor"}, `<div class="ql-editor"></div>`},
+	}
+
+	for i, tc := range cases {
+		got, err := RenderWithOptions(tc.ops, tc.opts)
+		if err != nil {
+			t.Fatalf("(index %d) %s", i, err)
+		}
+		if string(got) != tc.want {
+			t.Errorf("(index %d) bad rendering; got: %s", i, got)
+		}
+	}
+
+	// A Renderer writes the root element for each rendering.
+	r := Renderer{Options: RenderOptions{RootClass: "ql-editor"}}
+	for i := 0; i < 2; i++ {
+		got, err := r.Render(ops)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := `<div class="ql-editor"><p class="ql-align-center">text</p></div>`; string(got) != want {
+			t.Errorf("(rendering %d) bad rendering with a Renderer; got: %s", i, got)
+		}
+	}
+
+}
+
+func TestRenderOptions_AllowRawHTML(t *testing.T) {
+
+	ops := []byte(`[{"insert":"a "},{"insert":{"raw":"<custom-widget data-id=\"7\"></custom-widget>"},"attributes":{"bold":true}},` +
+		`{"insert":" b\n"}]`)
+
+	cases := []struct {
+		opts RenderOptions
+		want string
+	}{
+		{RenderOptions{}, `<p>a  b</p>`},
+		{RenderOptions{AllowRawHTML: true}, `<p>a <strong><custom-widget data-id="7"></custom-widget></strong> b</p>`},
+	}
+
+	for i, tc := range cases {
+		got, err := RenderWithOptions(ops, tc.opts)
+		if err != nil {
+			t.Fatalf("(index %d) %s", i, err)
+		}
+		if string(got) != tc.want {
+			t.Errorf("(index %d) bad rendering; got: %s", i, got)
+		}
+	}
+
+	_, warnings, err := RenderWithWarnings(ops, RenderOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 1 || warnings[0].Op != 1 {
+		t.Errorf("bad warnings for a raw embed left out: %v", warnings)
+	}
+
+}
+
+func TestRenderOptions_StandaloneImages(t *testing.T) {
+
+	ops := []byte(`[{"insert":{"image":"a.png"}},{"insert":"\n"},{"insert":"see "},{"insert":{"image":"b.png"}},{"insert":" here\n"},` +
+		`{"insert":{"image":"c.png"},"attributes":{"link":"/c"}},{"insert":"\n"}]`)
+
+	// The inline image and the linked image are written in their paragraphs with any setting.
+	rest := `<p>see <img src="b.png"> here</p><p><a href="/c" target="_blank"><img src="c.png"></a></p>`
+
+	cases := []struct {
+		opts RenderOptions
+		want string
+	}{
+		{RenderOptions{}, `<p><img src="a.png"></p>` + rest},
+		{RenderOptions{StandaloneImages: ImageBare}, `<img src="a.png">` + rest},
+		{RenderOptions{StandaloneImages: ImageFigure}, `<figure><img src="a.png"></figure>` + rest},
+	}
+
+	for i, tc := range cases {
+		got, err := RenderWithOptions(ops, tc.opts)
+		if err != nil {
+			t.Fatalf("(index %d) %s", i, err)
+		}
+		if string(got) != tc.want {
+			t.Errorf("(index %d) bad rendering; got: %s", i, got)
+		}
+	}
+
+}
+
+func TestRenderOptions_FormatTemplates(t *testing.T) {
+
+	templates := map[string]FormatTemplate{
+		"bold":      {Tag: "b"},
+		"header":    {Tag: "h{{.Attrs.header}}", Class: "title title-{{.Attrs.header}}"},
+		"highlight": {Class: "hl hl-{{.Attrs.highlight}}"},
+	}
+
+	cases := []struct {
+		ops, want string
+	}{
+		{
+			`[{"insert":"a "},{"insert":"bold","attributes":{"bold":true}},{"insert":" and "},` +
+				`{"insert":"both","attributes":{"bold":true,"italic":true}},{"insert":"\n"}]`,
+			`<p>a <b>bold</b> and <b><em>both</em></b></p>`,
+		},
+		{
+			`[{"insert":"Title"},{"insert":"\n","attributes":{"header":2,"align":"center"}}]`,
+			`<h2 class="ql-align-center title title-2">Title</h2>`,
+		},
+		{
+			`[{"insert":"marked","attributes":{"highlight":"yellow"}},{"insert":"\n"}]`,
+			`<p><span class="hl hl-yellow">marked</span></p>`,
+		},
+		{
+			// A format with no template is written as usual.
+			`[{"insert":"x","attributes":{"italic":true}},{"insert":"\n","attributes":{"blockquote":true}}]`,
+			`<blockquote><em>x</em></blockquote>`,
+		},
+	}
+
+	for i, tc := range cases {
+		got, err := RenderWithOptions([]byte(tc.ops), RenderOptions{FormatTemplates: templates})
+		if err != nil {
+			t.Fatalf("(index %d) %s", i, err)
+		}
+		if string(got) != tc.want {
+			t.Errorf("(index %d) bad rendering; got: %s", i, got)
+		}
+	}
+
+	// A template giving a tag name that is not valid (here from the value of the attribute) cannot be used.
+	ops := []byte(`[{"insert":"Title"},{"insert":"\n","attributes":{"header":"1 onclick=alert(1)"}}]`)
+	got, err := RenderWithOptions(ops, RenderOptions{FormatTemplates: templates})
+	if rerr, ok := err.(*RenderError); !ok || rerr.OpIndex != 1 || len(got) != 0 {
+		t.Errorf("bad result for a tag name that is not valid; got %q with error %v", got, err)
+	}
+
+	_, err = RenderWithOptions(ops, RenderOptions{FormatTemplates: map[string]FormatTemplate{"header": {Tag: "h{{.Attrs"}}})
+	if rerr, ok := err.(*RenderError); !ok || !strings.Contains(rerr.Reason, `template for "header"`) {
+		t.Errorf("bad error for a template that cannot be parsed; got %v", err)
+	}
+
+}
@@ -0,0 +1,371 @@
+package quill
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// ParseHTML takes HTML and returns a Delta (a JSON array of insert operations) with the same content, in the form given
+// by NormalizeDelta. It is the reverse of Render for the built-in formats: the elements, classes, and styles that Render
+// writes for paragraphs, headers, block quotes, lists, code blocks, dividers, images (with captions), line breaks,
+// links, and the inline formats are read back as the attributes that produce them, so that rendering the Delta gives
+// the same HTML. The text of any other elements is kept without formatting.
+func ParseHTML(src []byte) ([]byte, error) {
+
+	nodes, err := html.ParseFragment(bytes.NewReader(src), &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body})
+	if err != nil {
+		return nil, err
+	}
+
+	p := new(htmlParser)
+	for _, n := range nodes {
+		p.node(n, nil)
+	}
+	if p.lineOpen {
+		p.endLine(nil) // The last line was not in a block element.
+	}
+
+	ops, err := json.Marshal(p.ops)
+	if err != nil {
+		return nil, err
+	}
+	return NormalizeDelta(ops)
+
+}
+
+// An htmlParser collects the ops of a Delta while walking through an HTML tree.
+type htmlParser struct {
+	ops      []rawOp
+	lineOpen bool // whether inline content has been added since the last line ended
+}
+
+// insert adds an op with a copy of the attributes.
+func (p *htmlParser) insert(ins interface{}, attrs map[string]interface{}) {
+	var cp map[string]interface{}
+	if len(attrs) > 0 {
+		cp = make(map[string]interface{}, len(attrs))
+		for k, v := range attrs {
+			cp[k] = v
+		}
+	}
+	p.ops = append(p.ops, rawOp{Insert: ins, Attrs: cp})
+}
+
+// endLine adds the "\n" ending a line with the block attributes of the line.
+func (p *htmlParser) endLine(attrs map[string]interface{}) {
+	p.insert("\n", attrs)
+	p.lineOpen = false
+}
+
+// node adds the ops for n and its children, which have the inline attributes given.
+func (p *htmlParser) node(n *html.Node, inline map[string]interface{}) {
+
+	switch n.Type {
+	case html.TextNode:
+		// Whitespace between blocks (such as in indented HTML) is not content.
+		if !p.lineOpen && strings.TrimSpace(n.Data) == "" {
+			return
+		}
+		p.insert(n.Data, inline)
+		p.lineOpen = true
+		return
+	case html.ElementNode:
+	default:
+		return
+	}
+
+	switch n.DataAtom {
+	case atom.P:
+		p.block(n, lineAttrs(n))
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		attrs := lineAttrs(n)
+		attrs["header"] = int(n.Data[1] - '0')
+		p.block(n, attrs)
+	case atom.Blockquote:
+		attrs := lineAttrs(n)
+		attrs["blockquote"] = true
+		if cite, ok := htmlAttr(n, "cite"); ok {
+			attrs["cite"] = cite
+		}
+		p.block(n, attrs)
+	case atom.Pre:
+		p.codeBlock(n)
+	case atom.Ul, atom.Ol:
+		p.list(n, 0)
+	case atom.Hr:
+		p.closeLine()
+		p.insert(map[string]interface{}{"divider": true}, nil)
+		p.endLine(nil)
+	case atom.Br:
+		// A <br> alone in an element is the content of an empty paragraph; any other is a soft line break.
+		if p.lineOpen || n.PrevSibling != nil || n.NextSibling != nil {
+			p.insert(map[string]interface{}{"break": true}, inline)
+			p.lineOpen = true
+		}
+	case atom.Img:
+		p.image(n, copyAttrs(inline))
+	case atom.Figure:
+		if img := childElement(n, atom.Img); img != nil {
+			// An image with a caption.
+			p.closeLine()
+			attrs := make(map[string]interface{}, 1)
+			if caption := childElement(n, atom.Figcaption); caption != nil {
+				var text strings.Builder
+				htmlText(caption, &text)
+				attrs["caption"] = text.String()
+			}
+			p.image(img, attrs)
+			p.endLine(nil)
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			p.node(c, inline)
+		}
+	default:
+		attrs := inlineAttrs(n, inline)
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			p.node(c, attrs)
+		}
+	}
+
+}
+
+// image adds an image embed with the attributes given along with those read from the <img> element.
+func (p *htmlParser) image(n *html.Node, attrs map[string]interface{}) {
+	for _, name := range [...]string{"alt", "width", "height"} {
+		if val, ok := htmlAttr(n, name); ok {
+			attrs[name] = val
+		}
+	}
+	src, _ := htmlAttr(n, "src")
+	p.insert(map[string]interface{}{"image": src}, attrs)
+	p.lineOpen = true
+}
+
+// closeLine ends the line of any inline content not in a block element before a block element begins.
+func (p *htmlParser) closeLine() {
+	if p.lineOpen {
+		p.endLine(nil)
+	}
+}
+
+// block adds the content of a block element as a line with the block attributes given.
+func (p *htmlParser) block(n *html.Node, attrs map[string]interface{}) {
+	p.closeLine()
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		p.node(c, nil)
+	}
+	p.endLine(attrs)
+}
+
+// codeBlock adds each line of the text of a <pre> element as a line of a code block.
+func (p *htmlParser) codeBlock(n *html.Node) {
+
+	p.closeLine()
+
+	var lang interface{} = true
+	if code := n.FirstChild; code != nil && code.DataAtom == atom.Code {
+		class, _ := htmlAttr(code, "class")
+		if strings.HasPrefix(class, "language-") {
+			lang = strings.TrimPrefix(class, "language-")
+		}
+	}
+
+	var text strings.Builder
+	htmlText(n, &text)
+
+	lines := strings.Split(strings.TrimSuffix(text.String(), "\n"), "\n")
+	for _, line := range lines {
+		if line != "" {
+			p.insert(line, nil)
+		}
+		p.endLine(map[string]interface{}{"code-block": lang})
+	}
+
+}
+
+// list adds each item of a list as a line. A list within an item is added after the line of the item with its items
+// indented one level further than those of the list containing it, which is how Quill represents nested lists.
+func (p *htmlParser) list(n *html.Node, indent int) {
+
+	p.closeLine()
+
+	listType := "bullet"
+	if n.DataAtom == atom.Ol {
+		listType = "ordered"
+	} else if checked, ok := htmlAttr(n, "data-checked"); ok {
+		if checked == "true" {
+			listType = "checked"
+		} else {
+			listType = "unchecked"
+		}
+	}
+
+	start, _ := htmlAttr(n, "start")
+
+	for li := n.FirstChild; li != nil; li = li.NextSibling {
+		if li.DataAtom != atom.Li {
+			continue
+		}
+		attrs := lineAttrs(li)
+		attrs["list"] = listType
+		level := indent
+		if in, ok := attrs["indent"].(int); ok {
+			level += in
+		}
+		if level > 0 {
+			attrs["indent"] = level
+		}
+		if n, err := strconv.Atoi(start); err == nil && n > 0 {
+			attrs["start"] = n // The start is given on the first item.
+			start = ""
+		}
+		p.listItem(li, attrs, level)
+	}
+
+}
+
+// listItem adds the content of a list item as a line with the attributes given, followed by the items of any lists
+// within it. Any content after a nested list is added as another item.
+func (p *htmlParser) listItem(li *html.Node, attrs map[string]interface{}, level int) {
+	p.closeLine()
+	ended := false
+	for c := li.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode && (c.DataAtom == atom.Ul || c.DataAtom == atom.Ol) {
+			if !ended {
+				p.endLine(attrs)
+				ended = true
+			}
+			p.list(c, level+1)
+			continue
+		}
+		p.node(c, nil)
+		if p.lineOpen {
+			ended = false
+		}
+	}
+	if !ended {
+		p.endLine(attrs)
+	}
+}
+
+// lineAttrs reads the block attributes given as classes of a block element.
+func lineAttrs(n *html.Node) map[string]interface{} {
+	attrs := make(map[string]interface{}, 2)
+	class, _ := htmlAttr(n, "class")
+	for _, c := range strings.Fields(class) {
+		switch {
+		case strings.HasPrefix(c, "align-"):
+			attrs["align"] = strings.TrimPrefix(c, "align-")
+		case strings.HasPrefix(c, "ql-align-"):
+			attrs["align"] = strings.TrimPrefix(c, "ql-align-")
+		case strings.HasPrefix(c, "ql-direction-"):
+			attrs["direction"] = strings.TrimPrefix(c, "ql-direction-")
+		case strings.HasPrefix(c, "ql-indent-"):
+			if in, err := strconv.Atoi(strings.TrimPrefix(c, "ql-indent-")); err == nil {
+				attrs["indent"] = in
+			}
+		}
+	}
+	return attrs
+}
+
+// inlineAttrs gives the inline attributes of the content of an inline element, adding the formats of the element to the
+// attributes of its parent.
+func inlineAttrs(n *html.Node, parent map[string]interface{}) map[string]interface{} {
+
+	attrs := copyAttrs(parent)
+
+	switch n.DataAtom {
+	case atom.Strong, atom.B:
+		attrs["bold"] = true
+	case atom.Em, atom.I:
+		attrs["italic"] = true
+	case atom.U, atom.Ins:
+		attrs["underline"] = true
+	case atom.S, atom.Strike, atom.Del:
+		attrs["strike"] = true
+	case atom.Sup:
+		attrs["script"] = "super"
+	case atom.Sub:
+		attrs["script"] = "sub"
+	case atom.Code:
+		attrs["code"] = true
+	case atom.A:
+		if href, ok := htmlAttr(n, "href"); ok {
+			attrs["link"] = href
+		}
+	case atom.Span:
+		class, _ := htmlAttr(n, "class")
+		for _, c := range strings.Fields(class) {
+			switch {
+			case strings.HasPrefix(c, "ql-size-"):
+				attrs["size"] = strings.TrimPrefix(c, "ql-size-")
+			case strings.HasPrefix(c, "ql-font-"):
+				attrs["font"] = strings.TrimPrefix(c, "ql-font-")
+			}
+		}
+		style, _ := htmlAttr(n, "style")
+		for _, decl := range strings.Split(style, ";") {
+			colon := strings.IndexByte(decl, ':')
+			if colon == -1 {
+				continue
+			}
+			val := strings.TrimSpace(decl[colon+1:])
+			switch strings.ToLower(strings.TrimSpace(decl[:colon])) {
+			case "color":
+				attrs["color"] = val
+			case "background-color":
+				attrs["background"] = val
+			case "font-size":
+				attrs["size"] = val
+			}
+		}
+	}
+
+	return attrs
+
+}
+
+func copyAttrs(attrs map[string]interface{}) map[string]interface{} {
+	cp := make(map[string]interface{}, len(attrs)+1)
+	for k, v := range attrs {
+		cp[k] = v
+	}
+	return cp
+}
+
+// htmlAttr gives the value of an attribute of an element and says if the element has the attribute.
+func htmlAttr(n *html.Node, name string) (string, bool) {
+	for _, a := range n.Attr {
+		if a.Namespace == "" && a.Key == name {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
+
+// childElement gives the first child of n that is an element of the type given, or nil if there is none.
+func childElement(n *html.Node, a atom.Atom) *html.Node {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode && c.DataAtom == a {
+			return c
+		}
+	}
+	return nil
+}
+
+// htmlText writes out all of the text within n.
+func htmlText(n *html.Node, text *strings.Builder) {
+	if n.Type == html.TextNode {
+		text.WriteString(n.Data)
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		htmlText(c, text)
+	}
+}
@@ -0,0 +1,97 @@
+package quill
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func TestParseHTML(t *testing.T) {
+
+	// The testdata pairs written only with formats that ParseHTML reads back.
+	pairNames := []string{"ops1", "nested", "ordering", "list1", "list2", "list3", "list4", "list5", "list6", "list7",
+		"checklist1", "indent", "code1", "code3", "code4", "rtl1"}
+
+	for _, n := range pairNames {
+		t.Run(n, func(t *testing.T) {
+
+			want, err := ioutil.ReadFile("./testdata/" + n + ".html")
+			if err != nil {
+				t.Fatalf("could not read %s.html; %s", n, err)
+			}
+
+			ops, err := ParseHTML(want)
+			if err != nil {
+				t.Fatalf("error parsing; %s", err)
+			}
+
+			got, err := Render(ops)
+			if err != nil {
+				t.Fatalf("error rendering %s; %s", ops, err)
+			}
+
+			if !bytes.Equal(got, want) {
+				t.Errorf("bad round trip of Delta %s; \nexpected: \n%s\ngot: \n%s\n", ops, want, got)
+			}
+
+		})
+	}
+
+}
+
+func TestParseHTML_delta(t *testing.T) {
+
+	cases := []struct {
+		html, want string
+	}{
+		{`<p>a <strong>b</strong></p>`, `[{"insert":"a "},{"insert":"b","attributes":{"bold":true}},{"insert":"\n"}]`},
+		{`plain`, `[{"insert":"plain"},{"insert":"\n"}]`},
+		{`<h2>Title</h2><hr><p><br></p>`, `[{"insert":"Title"},{"insert":"\n","attributes":{"header":2}},{"insert":{"divider":true}},{"insert":"\n"},{"insert":"\n"}]`},
+		{
+			`<p><img src="cat.png" alt="A cat"><span style="color: red;">red</span></p>`,
+			`[{"insert":{"image":"cat.png"},"attributes":{"alt":"A cat"}},{"insert":"red","attributes":{"color":"red"}},{"insert":"\n"}]`,
+		},
+		{
+			`<p>first<br>second</p><p><br></p>`,
+			`[{"insert":"first"},{"insert":{"break":true}},{"insert":"second"},{"insert":"\n"},{"insert":"\n"}]`,
+		},
+		{
+			`<figure><img src="cat.png" alt="A cat"><figcaption>Our cat</figcaption></figure>`,
+			`[{"insert":{"image":"cat.png"},"attributes":{"alt":"A cat","caption":"Our cat"}},{"insert":"\n"}]`,
+		},
+		{
+			`<blockquote cite="https://example.com/talk">quote</blockquote>`,
+			`[{"insert":"quote"},{"insert":"\n","attributes":{"blockquote":true,"cite":"https://example.com/talk"}}]`,
+		},
+		{
+			`<ol start="3"><li>c</li><li>d</li></ol>`,
+			`[{"insert":"c"},{"insert":"\n","attributes":{"list":"ordered","start":3}},{"insert":"d"},{"insert":"\n","attributes":{"list":"ordered"}}]`,
+		},
+		{
+			`<ul><li>a<ul><li>b</li></ul></li></ul>`,
+			`[{"insert":"a"},{"insert":"\n","attributes":{"list":"bullet"}},{"insert":"b"},{"insert":"\n","attributes":{"indent":1,"list":"bullet"}}]`,
+		},
+		{
+			`<ol><li>a<ul class="x"><li>b</li><li class="ql-indent-1">c</li></ul>d</li><li>e</li></ol>`,
+			`[{"insert":"a"},{"insert":"\n","attributes":{"list":"ordered"}},{"insert":"b"},{"insert":"\n","attributes":{"indent":1,"list":"bullet"}},` +
+				`{"insert":"c"},{"insert":"\n","attributes":{"indent":2,"list":"bullet"}},{"insert":"d"},{"insert":"\n","attributes":{"list":"ordered"}},` +
+				`{"insert":"e"},{"insert":"\n","attributes":{"list":"ordered"}}]`,
+		},
+		{
+			`<pre class="ql-syntax"><code class="language-go">x := 1
+</code></pre>`,
+			`[{"insert":"x := 1"},{"insert":"\n","attributes":{"code-block":"go"}}]`,
+		},
+	}
+
+	for i, tc := range cases {
+		got, err := ParseHTML([]byte(tc.html))
+		if err != nil {
+			t.Fatalf("(index %d) %s", i, err)
+		}
+		if string(got) != tc.want {
+			t.Errorf("(index %d) wanted %s; got: %s", i, tc.want, got)
+		}
+	}
+
+}
@@ -1,9 +1,11 @@
 package quill
 
 import (
+	"encoding/json"
 	"fmt"
-	"html"
+	"math"
 	"strconv"
+	"strings"
 )
 
 type rawOp struct {
@@ -11,51 +13,110 @@ type rawOp struct {
 	Insert interface{} `json:"insert"`
 
 	// Attrs contains the "attributes" property of the op.
-	Attrs map[string]interface{} `json:"attributes"`
+	Attrs map[string]interface{} `json:"attributes,omitempty"`
+}
+
+// A RenderError is returned when an op of a Delta cannot be rendered.
+type RenderError struct {
+	OpIndex int    // the index of the op in the Delta array
+	Op      rawOp  // the op as decoded from the JSON
+	Reason  string // a description of the problem
+}
+
+func (e *RenderError) Error() string {
+	if e.Op.Insert == nil && e.Op.Attrs == nil {
+		return fmt.Sprintf("quill: op %d %s", e.OpIndex, e.Reason)
+	}
+	return fmt.Sprintf("quill: op %d %s: %+v", e.OpIndex, e.Reason, e.Op)
+}
+
+// ParseDelta takes a Delta array of insert operations and returns the ops as they are given to Formatters, except that
+// the text of text inserts is not escaped. It is meant for tools that work with the ops of a Delta without rendering it.
+// Unlike rendering, which reuses a single Op for the whole Delta, ParseDelta allocates an Op (with its own Attrs map) for
+// each op. If an op is not usable, the error is a *RenderError giving its index.
+func ParseDelta(ops []byte) ([]Op, error) {
+
+	raw := make([]rawOp, 0, 12)
+	if err := json.Unmarshal(ops, &raw); err != nil {
+		return nil, err
+	}
+
+	parsed := make([]Op, len(raw))
+	for i := range raw {
+		parsed[i].Attrs = make(map[string]string, len(raw[i].Attrs))
+		if err := raw[i].makeOp(&parsed[i], i); err != nil {
+			return nil, err
+		}
+		if text, ok := raw[i].Insert.(string); ok {
+			parsed[i].Data = normalizeLineEnds(text)
+		}
+	}
+
+	return parsed, nil
+
 }
 
 // makeOp takes a raw Delta op as extracted from the JSON and turns it into an Op to make it usable for rendering.
-func (ro *rawOp) makeOp(o *Op) error {
+// The index of the op in the Delta array is given for the RenderError returned if the op is not usable.
+func (ro *rawOp) makeOp(o *Op, i int) error {
+	return ro.makeEscapedOp(o, i, EscapeNamed)
+}
+
+// makeEscapedOp is like makeOp but escapes the text of a text insert with the escaping given.
+func (ro *rawOp) makeEscapedOp(o *Op, i int, esc Escaping) error {
 
 	if ro.Insert == nil {
-		return fmt.Errorf("op %+v lacks an insert", *ro)
+		return &RenderError{OpIndex: i, Op: *ro, Reason: "lacks an insert"}
 	}
 
+	o.RawData = nil
+
 	switch ins := ro.Insert.(type) {
 	case string:
 		// This op is a simple string insert.
 		o.Type = "text"
-		o.Data = html.EscapeString(ins)
+		o.Data = esc.escape(normalizeLineEnds(ins))
 	case map[string]interface{}:
 		if len(ins) == 0 {
-			return fmt.Errorf("op %+v lacks a non-text insert", *ro)
+			return &RenderError{OpIndex: i, Op: *ro, Reason: "lacks a non-text insert"}
 		}
 		// There should be one item in the map (the element's key being the insert type).
 		for mk := range ins {
 			o.Type = mk
 			o.Data = extractString(ins[mk])
+			if _, ok := ins[mk].(string); !ok {
+				o.RawData = ins[mk]
+			}
 			break
 		}
 	default:
-		return fmt.Errorf("op %+v lacks an insert", *ro)
+		return &RenderError{OpIndex: i, Op: *ro, Reason: "lacks an insert"}
 	}
 
-	// Clear the map for reuse.
+	// Clear the map for reuse. The compiler makes this loop a single clear of the map, which is faster than deleting only
+	// the keys not set again.
 	for k := range o.Attrs {
 		delete(o.Attrs, k)
 	}
-
-	if ro.Attrs != nil {
-		// The map was already made
-		for attr := range ro.Attrs {
-			o.Attrs[attr] = extractString(ro.Attrs[attr])
-		}
+	for attr, v := range ro.Attrs {
+		o.Attrs[attr] = extractString(v)
 	}
 
 	return nil
 
 }
 
+// normalizeLineEnds replaces the Windows (CRLF) and old Mac (CR) line endings in the text with line feeds, which are
+// what end blocks in a Delta.
+func normalizeLineEnds(text string) string {
+	if strings.IndexByte(text, '\r') == -1 {
+		return text
+	}
+	return lineEndReplacer.Replace(text)
+}
+
+var lineEndReplacer = strings.NewReplacer("\r\n", "\n", "\r", "\n")
+
 func extractString(v interface{}) string {
 	switch val := v.(type) {
 	case string:
@@ -65,6 +126,10 @@ func extractString(v interface{}) string {
 			return "y"
 		}
 	case float64:
+		// Most numbers (such as header levels and indents) are small whole numbers, which FormatInt gives without allocating.
+		if val == math.Trunc(val) && math.Abs(val) < 1<<53 {
+			return strconv.FormatInt(int64(val), 10)
+		}
 		return strconv.FormatFloat(val, 'f', 0, 64)
 	}
 	return ""
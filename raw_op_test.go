@@ -1,85 +1,118 @@
 package quill
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"reflect"
+	"strconv"
 	"testing"
 )
 
-func TestRawOp_makeOp(t *testing.T) {
-
-	rawOps := []rawOp{
-		{
-			Insert: "stuff to insert.\n",
-			Attrs: map[string]interface{}{
-				"bold":      true,
-				"link":      "https://widerwebs.com",
-				"italic":    false,
-				"underline": nil, // nil value is set if JSON value is null
-			},
+// testRawOps are the raw ops of a Delta, which make the Op values of testOps.
+var testRawOps = []rawOp{
+	{
+		Insert: "stuff to insert.\n",
+		Attrs: map[string]interface{}{
+			"bold":      true,
+			"link":      "https://widerwebs.com",
+			"italic":    false,
+			"underline": nil, // nil value is set if JSON value is null
 		},
-		{
-			Insert: "\n",
-			Attrs: map[string]interface{}{
-				"align": "center",
-			},
+	},
+	{
+		Insert: "\n",
+		Attrs: map[string]interface{}{
+			"align": "center",
 		},
-		{
-			Insert: "\n",
-			Attrs: map[string]interface{}{
-				"align":      "center",
-				"blockquote": true,
-			},
+	},
+	{
+		Insert: "\n",
+		Attrs: map[string]interface{}{
+			"align":      "center",
+			"blockquote": true,
 		},
-		{
-			Insert: map[string]interface{}{
-				"image": "url-or-base64",
+	},
+	{
+		Insert: map[string]interface{}{
+			"video": map[string]interface{}{
+				"url":   "https://example.com/v.mp4",
+				"width": float64(300),
 			},
 		},
-	}
+	},
+	{
+		Insert: map[string]interface{}{
+			"divider": true,
+		},
+	},
+	{
+		Insert: map[string]interface{}{
+			"image": "url-or-base64",
+		},
+	},
+}
 
-	want := []Op{
-		{
-			Data: "stuff to insert.\n",
-			Type: "text",
-			Attrs: map[string]string{
-				"bold":      "y",
-				"italic":    "",
-				"link":      "https://widerwebs.com",
-				"underline": "",
-			},
+// testOps are the Op values made from testRawOps.
+var testOps = []Op{
+	{
+		Data: "stuff to insert.\n",
+		Type: "text",
+		Attrs: map[string]string{
+			"bold":      "y",
+			"italic":    "",
+			"link":      "https://widerwebs.com",
+			"underline": "",
 		},
-		{
-			Data: "\n",
-			Type: "text",
-			Attrs: map[string]string{
-				"align": "center",
-			},
+	},
+	{
+		Data: "\n",
+		Type: "text",
+		Attrs: map[string]string{
+			"align": "center",
 		},
-		{
-			Data: "\n",
-			Type: "text",
-			Attrs: map[string]string{
-				"align":      "center",
-				"blockquote": "y",
-			},
+	},
+	{
+		Data: "\n",
+		Type: "text",
+		Attrs: map[string]string{
+			"align":      "center",
+			"blockquote": "y",
 		},
-		{
-			Data:  "url-or-base64",
-			Type:  "image",
-			Attrs: make(map[string]string), // like in code (already initialized)
+	},
+	{
+		Type:  "video",
+		Attrs: make(map[string]string),
+		RawData: map[string]interface{}{
+			"url":   "https://example.com/v.mp4",
+			"width": float64(300),
 		},
-	}
+	},
+	{
+		Data:    "y",
+		Type:    "divider",
+		Attrs:   make(map[string]string),
+		RawData: true,
+	},
+	{
+		Data:  "url-or-base64",
+		Type:  "image",
+		Attrs: make(map[string]string), // like in code (already initialized)
+	},
+}
+
+func TestRawOp_makeOp(t *testing.T) {
 
 	o := new(Op)                         // reuse in loop
 	o.Attrs = make(map[string]string, 3) // initialize once here only (as in real code)
 
-	for i := range rawOps {
+	for i := range testRawOps {
 
-		if err := rawOps[i].makeOp(o); err != nil {
+		if err := testRawOps[i].makeOp(o, i); err != nil {
 			t.Fatalf("error making Op: %s", err)
 		}
 
-		if !reflect.DeepEqual(*o, want[i]) {
+		if !reflect.DeepEqual(*o, testOps[i]) {
 			t.Errorf("failed Op comparison; got %+v for index %d", o, i)
 		}
 
@@ -87,6 +120,37 @@ func TestRawOp_makeOp(t *testing.T) {
 
 }
 
+func TestParseDelta(t *testing.T) {
+
+	delta, err := json.Marshal(testRawOps)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ParseDelta(delta)
+	if err != nil {
+		t.Fatalf("error parsing: %s", err)
+	}
+	if !reflect.DeepEqual(got, testOps) {
+		t.Errorf("bad ops; got %+v", got)
+	}
+
+	// The text is given as it is in the Delta, not escaped for HTML.
+	got, err = ParseDelta([]byte(`[{"insert":"a < b\r\n"}]`))
+	if err != nil {
+		t.Fatalf("error parsing text: %s", err)
+	}
+	if want := []Op{{Data: "a < b\n", Type: "text", Attrs: map[string]string{}}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("bad text op; got %+v", got)
+	}
+
+	_, err = ParseDelta([]byte(`[{"insert":"abc\n"},{"insert":{}}]`))
+	if rerr, ok := err.(*RenderError); !ok || rerr.OpIndex != 1 {
+		t.Errorf("bad error for an unusable op; got %v", err)
+	}
+
+}
+
 func TestExtractString(t *testing.T) {
 	if extractString("random string") != "random string" {
 		t.Errorf("failed stringc extract")
@@ -100,4 +164,78 @@ func TestExtractString(t *testing.T) {
 	if extractString(float64(3)) != "3" {
 		t.Errorf("failed float64 extract")
 	}
+	for f, want := range map[float64]string{300: "300", -12: "-12", 1.5: "2", 1e21: "1000000000000000000000"} {
+		if got := extractString(f); got != want {
+			t.Errorf("failed float64 extract of %v; got %q", f, got)
+		}
+	}
+}
+
+func TestRenderError(t *testing.T) {
+
+	cases := []struct {
+		ops     string
+		opIndex int
+		reason  string
+	}{
+		{`[{"insert":"abc\n"},{"attributes":{"bold":true}}]`, 1, "lacks an insert"},
+		{`[{"insert":"abc\n"},{"insert":"def"},{"insert":{}}]`, 2, "lacks a non-text insert"},
+		{`[{"insert":{"unknown":"x"}}]`, 0, "does not have a format defined for its type"},
+	}
+
+	for i, c := range cases {
+
+		_, err := RenderExtended([]byte(c.ops), nil)
+
+		var re *RenderError
+		if !errors.As(err, &re) {
+			t.Errorf("(index %d) got error %v; wanted a *RenderError", i, err)
+			continue
+		}
+		if re.OpIndex != c.opIndex || re.Reason != c.reason {
+			t.Errorf("(index %d) got op index %d with reason %q", i, re.OpIndex, re.Reason)
+		}
+
+	}
+
+}
+
+// largeDelta makes a Delta of many small ops with the kinds of attributes that editors commonly set.
+func largeDelta(n int) []byte {
+	var buf bytes.Buffer
+	buf.WriteByte('[')
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		switch i % 4 {
+		case 0:
+			buf.WriteString(`{"insert":"Some text to render "}`)
+		case 1:
+			buf.WriteString(`{"insert":"bold italic","attributes":{"bold":true,"italic":true}}`)
+		case 2:
+			buf.WriteString(`{"insert":"\n","attributes":{"header":` + strconv.Itoa(i%6+1) + `}}`)
+		case 3:
+			buf.WriteString(`{"insert":"\n","attributes":{"list":"bullet","indent":` + strconv.Itoa(i%12) + `}}`)
+		}
+	}
+	buf.WriteByte(']')
+	return buf.Bytes()
+}
+
+func BenchmarkRawOp_makeOp(b *testing.B) {
+	var raw []rawOp
+	if err := json.Unmarshal(largeDelta(10000), &raw); err != nil {
+		b.Fatal(err)
+	}
+	o := &Op{Attrs: make(map[string]string, 3)}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		for i := range raw {
+			if err := raw[i].makeOp(o, i); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
 }
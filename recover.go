@@ -0,0 +1,131 @@
+package quill
+
+import (
+	"fmt"
+	"io"
+)
+
+// formatter gives the Formatter for the keyword for the current op from the custom formats, the FormatTemplates, or the
+// built-in formats. A Formatter that comes from the CustomFormats option or the registered formats is guarded so that a
+// panic in any of its methods is recovered from (see recoverCustom).
+func (vars *renderVars) formatter(keyword string) (Formatter, error) {
+
+	custom := vars.customFormatter(keyword)
+
+	if custom == nil {
+		if tf, err := vars.templateFormatter(keyword); tf != nil || err != nil {
+			return tf, err
+		}
+		return vars.o.builtInFormatter(keyword, vars.opts), nil
+	}
+
+	return vars.guard(custom), nil
+
+}
+
+// customFormatter gives the Formatter for the keyword from the custom formats, recovering from a panic in the function
+// giving it.
+func (vars *renderVars) customFormatter(keyword string) Formatter {
+	defer vars.recoverCustom()
+	return vars.o.customFormatter(keyword, vars.opts)
+}
+
+// recoverCustom recovers from a panic in custom code and panics again with a RenderError about the current op, which is
+// then returned by the rendering (see stopCustom). It must be called directly by a deferred call.
+func (vars *renderVars) recoverCustom() {
+	r := recover()
+	if r == nil {
+		return
+	}
+	if vars.customErr == nil {
+		vars.customErr = &RenderError{OpIndex: vars.opIndex, Reason: fmt.Sprintf("could not be rendered because a formatter panicked (%v)", r)}
+	}
+	panic(vars.customErr)
+}
+
+// stopCustom sets *err to the RenderError of a panic that began in custom code. Any other panic is a bug in the rendering
+// and is not recovered from, so it goes on with its own stack. It must be called directly by a deferred call.
+func (vars *renderVars) stopCustom(err *error) {
+	if vars.customErr == nil {
+		return
+	}
+	recover()
+	*err = vars.customErr
+	vars.customErr = nil
+}
+
+// guard wraps a custom Formatter so that a panic in any of its methods is recovered from. The wrapper implements the
+// same interfaces of this package as the Formatter.
+func (vars *renderVars) guard(f Formatter) Formatter {
+	g := guarded{f: f, vars: vars}
+	wr, isWriter := f.(FormatWriter)
+	fw, isWrapper := f.(FormatWrapper)
+	switch {
+	case isWriter && isWrapper:
+		return &guardedWriterWrapper{guardedWrapper{g, fw}, wr}
+	case isWriter:
+		return &guardedWriter{g, wr}
+	case isWrapper:
+		return &guardedWrapper{g, fw}
+	}
+	return &g
+}
+
+// guarded is a custom Formatter of which the methods are called with recoverCustom deferred.
+type guarded struct {
+	f    Formatter
+	vars *renderVars
+}
+
+func (g *guarded) Fmt() *Format {
+	defer g.vars.recoverCustom()
+	return g.f.Fmt()
+}
+
+func (g *guarded) HasFormat(o *Op) bool {
+	defer g.vars.recoverCustom()
+	return g.f.HasFormat(o)
+}
+
+// guardedWriter is a guarded FormatWriter.
+type guardedWriter struct {
+	guarded
+	writer FormatWriter
+}
+
+func (g *guardedWriter) Write(w io.Writer) {
+	defer g.vars.recoverCustom()
+	g.writer.Write(w)
+}
+
+// guardedWrapper is a guarded FormatWrapper.
+type guardedWrapper struct {
+	guarded
+	wrapper FormatWrapper
+}
+
+func (g *guardedWrapper) Wrap() (string, string) {
+	defer g.vars.recoverCustom()
+	return g.wrapper.Wrap()
+}
+
+func (g *guardedWrapper) Open(open []*Format, o *Op) bool {
+	defer g.vars.recoverCustom()
+	return g.wrapper.Open(open, o)
+}
+
+func (g *guardedWrapper) Close(open []*Format, o *Op, doingBlock bool) bool {
+	defer g.vars.recoverCustom()
+	return g.wrapper.Close(open, o, doingBlock)
+}
+
+// guardedWriterWrapper is a guarded Formatter that is both a FormatWriter and a FormatWrapper.
+type guardedWriterWrapper struct {
+	guardedWrapper
+	writer FormatWriter
+}
+
+func (g *guardedWriterWrapper) Write(w io.Writer) {
+	defer g.vars.recoverCustom()
+	g.writer.Write(w)
+}
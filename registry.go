@@ -0,0 +1,44 @@
+package quill
+
+import (
+	"sync"
+)
+
+// registry holds the formats registered with RegisterFormat.
+var registry struct {
+	sync.RWMutex
+	formats map[string]func(*Op) Formatter
+}
+
+// RegisterFormat makes factory provide the Formatter for the keyword (an insert type such as "video" or an attribute
+// name) in every rendering, the way that CustomFormats does for a single rendering. If both give a Formatter for an op,
+// the one from CustomFormats is used. A format registered for the keyword of a built-in format replaces the built-in
+// format, except for the ops for which factory returns nil. Registering a nil factory removes the format registered
+// for the keyword.
+//
+// Formats are meant to be registered once during initialization (such as in an init function of a package providing
+// them). RegisterFormat is safe to call while Deltas are being rendered, but whether a rendering already started uses
+// the new format is unspecified.
+func RegisterFormat(keyword string, factory func(*Op) Formatter) {
+	registry.Lock()
+	defer registry.Unlock()
+	if factory == nil {
+		delete(registry.formats, keyword)
+		return
+	}
+	if registry.formats == nil {
+		registry.formats = make(map[string]func(*Op) Formatter)
+	}
+	registry.formats[keyword] = factory
+}
+
+// registeredFormat gives the Formatter from the format registered for the keyword, or nil if there is none.
+func registeredFormat(keyword string, o *Op) Formatter {
+	registry.RLock()
+	factory := registry.formats[keyword]
+	registry.RUnlock()
+	if factory == nil {
+		return nil
+	}
+	return factory(o)
+}
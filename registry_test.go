@@ -0,0 +1,70 @@
+package quill
+
+import (
+	"testing"
+)
+
+// heavyFormat is a custom format for the "bold" attribute with the value "heavy".
+type heavyFormat struct{}
+
+func (*heavyFormat) Fmt() *Format { return new(Format) } // Only a wrapper.
+
+func (*heavyFormat) HasFormat(*Op) bool { return false }
+
+func (*heavyFormat) Wrap() (string, string) { return `<b class="heavy">`, "</b>" }
+
+func (*heavyFormat) Open(_ []*Format, _ *Op) bool { return true }
+
+func (*heavyFormat) Close(_ []*Format, o *Op, doingBlock bool) bool {
+	return doingBlock || o.Attrs["bold"] != "heavy"
+}
+
+func TestRegisterFormat(t *testing.T) {
+
+	RegisterFormat("video", func(o *Op) Formatter {
+		v, _ := o.RawData.(map[string]interface{})
+		return &videoFormat{src: extractString(v["url"]), width: extractString(v["width"])}
+	})
+	RegisterFormat("bold", func(o *Op) Formatter {
+		if o.Attrs["bold"] == "heavy" {
+			return new(heavyFormat)
+		}
+		return nil // Use the built-in format.
+	})
+	defer RegisterFormat("video", nil)
+	defer RegisterFormat("bold", nil)
+
+	ops := []byte(`[{"insert":{"video":{"url":"https://example.com/v.mp4","width":300}}},{"insert":"\n"},` +
+		`{"insert":"heavy","attributes":{"bold":"heavy"}},{"insert":" bold","attributes":{"bold":true}},{"insert":"\n"}]`)
+
+	want := `<p><video src="https://example.com/v.mp4" width="300"></video></p>` +
+		`<p><b class="heavy">heavy</b><strong> bold</strong></p>`
+
+	got, err := Render(ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Errorf("bad rendering; got: %s", got)
+	}
+
+	// The CustomFormats of a rendering are used before the registered formats.
+	got, err = RenderExtended([]byte(`[{"insert":{"video":"v.mp4"}},{"insert":"\n"}]`), func(keyword string, o *Op) Formatter {
+		if keyword == "video" {
+			return &videoFormat{src: o.Data, width: "100"}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want = `<p><video src="v.mp4" width="100"></video></p>`; string(got) != want {
+		t.Errorf("bad rendering; got: %s", got)
+	}
+
+	RegisterFormat("video", nil)
+	if _, err = Render(ops); err == nil {
+		t.Error("no error rendering an unknown embed after the format is removed")
+	}
+
+}
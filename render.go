@@ -3,15 +3,22 @@
 //
 // This library is designed to be easily extendable. Simply call RenderExtended with a function that may provide its
 // own formats for certain kinds of ops and attributes.
+//
+// The rendering functions keep no state between calls, so they may be called from multiple goroutines at once (as long
+// as the Formatters given to them are also safe for that). A Renderer, however, may be used by only one goroutine at a
+// time.
 package quill
 
 import (
 	"bytes"
 	"encoding/json"
-	"fmt"
+	"html"
 	"io"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"text/template"
 )
 
 // Render takes a Delta array of insert operations and returns the rendered HTML using the built-in settings.
@@ -23,83 +30,252 @@ func Render(ops []byte) ([]byte, error) {
 // RenderExtended takes a Delta array of insert operations and, optionally, a function that may provide a Formatter to
 // customize the way certain kinds of inserts are rendered, and returns the rendered HTML. If the given Formatter is nil,
 // then the default one that is built in is used. If an error occurs while rendering, any HTML already rendered is returned.
+// A panic in a custom Formatter is returned as a RenderError for the op being rendered.
 func RenderExtended(ops []byte, customFormats func(string, *Op) Formatter) ([]byte, error) {
+	return RenderWithOptions(ops, RenderOptions{CustomFormats: customFormats})
+}
+
+// RenderWithOptions takes a Delta array of insert operations and returns the HTML rendered according to opts.
+// If an error occurs while rendering, any HTML already rendered is returned.
+func RenderWithOptions(ops []byte, opts RenderOptions) ([]byte, error) {
+	vars := newRenderVars(&opts)
+	return vars.render(ops)
+}
+
+// newRenderVars sets up the variables for a single rendering.
+func newRenderVars(opts *RenderOptions) *renderVars {
+	return &renderVars{
+		fs:   make(formatState, 0, 4),
+		fms:  make([]*Format, 0, 4),
+		o:    Op{Attrs: make(map[string]string, 3)},
+		opts: opts,
+	}
+}
+
+// render takes a Delta array of insert operations and renders the HTML into the final buffer.
+func (vars *renderVars) render(ops []byte) ([]byte, error) {
 
 	raw := make([]rawOp, 0, 12)
 	if err := json.Unmarshal(ops, &raw); err != nil {
 		return nil, err
 	}
 
-	vars := renderVars{
-		fs:  make(formatState, 0, 4),
-		fms: make([]*Format, 0, 4),
-		o:   Op{Attrs: make(map[string]string, 3)},
-	}
-
 	for i := range raw {
-
-		if err := raw[i].makeOp(&vars.o); err != nil {
+		if err := vars.renderOp(i, &raw[i]); err != nil {
 			return vars.finalBuf.Bytes(), err
 		}
+	}
 
-		vars.fms = vars.fms[:0] // Reset the slice for the current Op iteration.
+	return vars.finish()
 
-		// To set up fms, first check the Op insert type.
-		typeFmTer := vars.o.getFormatter(vars.o.Type, customFormats)
-		if typeFmTer == nil {
-			return vars.finalBuf.Bytes(), fmt.Errorf("quill: an op does not have a format defined for its type: %v", raw[i])
-		}
-		vars.o.addFmTer(&vars, typeFmTer)
+}
 
-		// Get a Formatter out of each of the attributes.
-		for attr := range vars.o.Attrs {
-			vars.o.addFmTer(&vars, vars.o.getFormatter(attr, customFormats))
+// renderOp renders a single op, the one at index i in the Delta.
+func (vars *renderVars) renderOp(i int, ro *rawOp) (err error) {
+
+	defer vars.stopCustom(&err)
+
+	if err := vars.flush(); err != nil {
+		return err
+	}
+
+	vars.openRoot()
+
+	vars.opIndex = i
+
+	if err := ro.makeEscapedOp(&vars.o, i, vars.opts.Escaping); err != nil {
+		return vars.invalidOp(err)
+	}
+
+	if vars.opts.TransformOp != nil {
+		if text, ok := ro.Insert.(string); ok {
+			vars.o.Data = normalizeLineEnds(text) // The hook is given the plain text.
+		}
+		vars.opts.TransformOp(&vars.o)
+		if vars.o.Type == "text" {
+			vars.o.Data = vars.opts.Escaping.escape(vars.o.Data)
 		}
+	}
 
-		// Open a block element, write its body, and close it to move on only when the ending "\n" of the block is reached.
-		if strings.IndexByte(vars.o.Data, '\n') != -1 {
+	if vars.opts.Filter != nil && !vars.opts.Filter(&vars.o) {
+		vars.warn("skipped by the filter")
+		return nil
+	}
 
-			// Extract text from between the block-terminating line feeds and write each part as its own Op.
-			split := strings.Split(vars.o.Data, "\n")
+	if vars.o.Type == "raw" && !vars.opts.AllowRawHTML {
+		vars.warn("raw HTML is not allowed")
+		return nil
+	}
+	if vars.o.Type == "image" && !vars.opts.allowedImage(vars.o.Data) {
+		vars.warn("image source %q is not allowed", vars.o.Data)
+		return nil
+	}
+	if href, ok := vars.o.Attrs["link"]; ok && !vars.opts.allowedURL(href) {
+		vars.warn("link %q is not allowed", href)
+		delete(vars.o.Attrs, "link")
+	}
 
-			for j := range split {
+	vars.fms = vars.fms[:0] // Reset the slice for the current Op iteration.
+	vars.writers = vars.writers[:0]
 
-				vars.o.Data = split[j]
+	// To set up fms, first check the Op insert type.
+	typeFmTer, err := vars.formatter(vars.o.Type)
+	if err != nil {
+		return vars.invalidOp(err)
+	}
+	if typeFmTer == nil {
+		return vars.invalidOp(&RenderError{OpIndex: i, Op: *ro, Reason: "does not have a format defined for its type"})
+	}
+	vars.o.addFmTer(vars, typeFmTer)
+
+	// Get a Formatter out of each of the attributes.
+	for attr := range vars.o.Attrs {
+		fmTer, err := vars.formatter(attr)
+		if err != nil {
+			vars.ignored, vars.unknown = vars.ignored[:0], vars.unknown[:0]
+			return vars.invalidOp(err)
+		}
+		if fmTer == nil && vars.o.Attrs[attr] != "" && !auxiliaryAttr(attr) {
+			if vars.opts.PreserveUnknownAttrs && dataAttrName(attr) {
+				vars.unknown = append(vars.unknown, attr)
+			} else if vars.warnings != nil {
+				vars.ignored = append(vars.ignored, attr)
+			}
+		}
+		vars.o.addFmTer(vars, fmTer)
+	}
+	vars.warnIgnored()
+	vars.addUnknown()
+
+	// Open a block element, write its body, and close it to move on only when the ending "\n" of the block is reached.
+	if strings.IndexByte(vars.o.Data, '\n') != -1 {
 
-				// If the current o.Data still has an "\n" following (its not the last in split), then it ends a block.
-				if j < len(split)-1 {
+		// Extract text from between the block-terminating line feeds and write each part as its own Op.
+		split := strings.Split(vars.o.Data, "\n")
 
-					vars.o.writeBlock(&vars)
+		for j := range split {
 
-				} else if vars.o.Data != "" { // If the last element in split is just "" then the last character in the rawOp is "\n".
+			vars.o.Data = split[j]
 
-					vars.o.writeInline(&vars)
+			// If the current o.Data still has an "\n" following (its not the last in split), then it ends a block.
+			if j < len(split)-1 {
 
+				// The text of the block is written with its inline formats before the block is closed.
+				if vars.o.Data != "" {
+					vars.o.writeInline(vars)
+					vars.o.Data = ""
 				}
+				vars.o.writeBlock(vars)
+
+			} else if vars.o.Data != "" { // If the last element in split is just "" then the last character in the rawOp is "\n".
+
+				vars.o.writeInline(vars)
 
 			}
 
-		} else {
-			vars.o.writeInline(&vars)
 		}
 
+	} else {
+		vars.o.writeInline(vars)
 	}
 
-	// Before writing out the final buffer, close the last remaining tags set by a FormatWrapper.
-	// The FormatWrapper should see that all styling is now done.
-	vars.fs.closePrevious(&vars.finalBuf, blankOp(), true)
+	return nil
+
+}
+
+// invalidOp gives the error for an op that cannot be rendered or, if the SkipInvalidOps option is set, records the
+// problem as a warning and gives nil so that the op is skipped.
+func (vars *renderVars) invalidOp(err error) error {
+	re, ok := err.(*RenderError)
+	if !ok || !vars.opts.SkipInvalidOps {
+		return err
+	}
+	vars.warn("skipped because it %s", re.Reason)
+	return nil
+}
+
+// openRoot writes the opening tag of the root element if the RootClass option is set and it has not been written yet.
+func (vars *renderVars) openRoot() {
+	if vars.opts.RootClass != "" && !vars.rooted {
+		vars.finalBuf.WriteString("<div class=" + quoteAttr(vars.opts.RootClass) + ">")
+		vars.rooted = true
+	}
+}
+
+// finish closes what is left open after all of the ops are rendered and returns the final output.
+func (vars *renderVars) finish() ([]byte, error) {
+
+	if err := vars.closeFormats(); err != nil {
+		return vars.finalBuf.Bytes(), err
+	}
+	if vars.opts.TrimTrailingEmpty && vars.blankLines > 0 {
+		vars.blankLines-- // Drop the empty paragraph at the end.
+	}
+	vars.writeBlankLines()
+	vars.writeFootnotes()
+
+	if vars.opts.RootClass != "" {
+		vars.openRoot() // The Delta may have had no ops.
+		vars.finalBuf.WriteString("</div>")
+	}
+
+	if vars.w != nil {
+		return nil, vars.flush()
+	}
+
+	if vars.opts.Sanitizer != nil {
+		return vars.opts.Sanitizer(vars.finalBuf.Bytes()), nil
+	}
 
 	return vars.finalBuf.Bytes(), nil
 
 }
 
+// closeFormats closes the last remaining tags before the final buffer is written out. A FormatWrapper should see that
+// all styling is now done.
+func (vars *renderVars) closeFormats() (err error) {
+	defer vars.stopCustom(&err)
+	vars.fs.closePrevious(&vars.finalBuf, blankOp(), true)
+	return nil
+}
+
 // renderVars combines the variables created in RenderExtended into a single allocation.
 type renderVars struct {
-	finalBuf bytes.Buffer // the final output
-	tempBuf  bytes.Buffer // temporary buffer reused for each block element
-	fs       formatState  // the tags currently open in the order in which they were opened
-	fms      []*Format    // reused slice for the the Formatter types defined for each Op
-	o        Op           // an Op to reuse for all iterations
+	finalBuf bytes.Buffer   // the final output
+	tempBuf  bytes.Buffer   // temporary buffer reused for each block element
+	fs       formatState    // the tags currently open in the order in which they were opened
+	fms      []*Format      // reused slice for the the Formatter types defined for each Op
+	writers  []FormatWriter // reused slice for the inline FormatWriter types of each Op, written after its inline formats
+	o        Op             // an Op to reuse for all iterations
+	opIndex  int            // the index of the Op being rendered
+	opts     *RenderOptions // the settings for rendering
+	embedEnd int            // where a block embed that starts the current line ends in tempBuf (0 if there is none)
+	embedTag string         // the tag name of the element around a block embed alone on its line (if any)
+
+	blankLines int // the number of blank lines held back (see RenderOptions.MergeLists and TrimTrailingEmpty)
+
+	headerIDs map[string]bool // the IDs given to headers so far
+
+	rooted bool // whether the opening tag of the root element has been written (see RenderOptions.RootClass)
+
+	unwrapped bool // whether the last block was a paragraph written without a <p> tag (see RenderOptions.UnwrapParagraphs)
+
+	footnotes bytes.Buffer // the footnote definitions, written after the rest of the document
+
+	w io.Writer // where the completed output is written as rendering goes on (nil if it stays in finalBuf)
+
+	warnings *[]Warning // where warnings are collected (nil if they are not)
+	ignored  []string   // reused slice for the ignored attributes of each Op
+
+	unknown []string // reused slice for the attributes of each Op to write as data-* attributes
+
+	mapping bool            // whether source mappings are recorded
+	srcMap  []SourceMapping // the source mappings of the final output
+	tempMap []SourceMapping // the source mappings of the temporary buffer (offsets are relative to tempBuf)
+
+	customErr *RenderError // the error for a panic in custom code that is being recovered from (see recoverCustom)
+
+	templates map[string]*template.Template // the parsed FormatTemplates fields, by their text
 }
 
 // addFmTer adds the format from fmTer to fms (the temporary, current Op's formats) if the format is not already set in the
@@ -110,12 +286,28 @@ func (o *Op) addFmTer(vars *renderVars, fmTer Formatter) {
 		return
 	}
 	fm := fmTer.Fmt()
-	if fm == nil {
-		// Check if the format is a FormatWriter. If it is, just write it out and continue.
-		if wr, ok := fmTer.(FormatWriter); ok {
-			wr.Write(&vars.tempBuf)
-			o.Data = ""
+	// Check if the format is a FormatWriter. If it is, write it out (or, for an inline embed, hold it to be written within
+	// the inline formats of the op) and continue.
+	if wr, ok := fmTer.(FormatWriter); ok && fm == nil {
+		vars.writers = append(vars.writers, wr)
+		o.Data = ""
+		return
+	}
+	if wr, ok := fmTer.(FormatWriter); ok && fm.Block {
+		vars.mapTemp()
+		alone := vars.tempBuf.Len() == 0
+		wr.Write(&vars.tempBuf)
+		if alone {
+			vars.embedEnd = vars.tempBuf.Len() // A block embed starts the line.
+			vars.embedTag = ""
+			if fm.Place == Tag {
+				vars.embedTag = fm.Val
+			}
 		}
+		o.Data = ""
+		return
+	}
+	if fm == nil {
 		return
 	}
 	fm.fm = fmTer
@@ -133,9 +325,10 @@ func (o *Op) addFmTer(vars *renderVars, fmTer Formatter) {
 // An Op is a Delta insert operations (https://github.com/quilljs/delta#insert) that has been converted into this format for
 // usability with the type safety in Go.
 type Op struct {
-	Data  string            // the text to insert or the value of the embed object (http://quilljs.com/docs/delta/#embeds)
-	Type  string            // the type of the op (typically "text", but any other type can be registered)
-	Attrs map[string]string // key is attribute name; value is either the attribute value or "y" (meaning true)
+	Data    string            // the text to insert or the value of the embed object (http://quilljs.com/docs/delta/#embeds)
+	Type    string            // the type of the op (typically "text", but any other type can be registered)
+	Attrs   map[string]string // key is attribute name; value is either the attribute value or "y" (meaning true)
+	RawData interface{}       // the value of an embed that is not a string (such as an object), as decoded from JSON
 }
 
 // writeBlock writes a block element (which may be nested inside another block element if it is a FormatWrapper).
@@ -143,6 +336,30 @@ type Op struct {
 // block is reached (the Op with the "\n" character holds the information about the block element).
 func (o *Op) writeBlock(vars *renderVars) {
 
+	blank := o.Type == "text" && len(o.Attrs) == 0 && o.Data == "" && vars.tempBuf.Len() == 0
+
+	// With MergeLists, a blank line following a list is held back until it is known whether the list continues after it.
+	if vars.opts.MergeLists {
+		open := vars.fs.openList()
+		if open != nil && blank {
+			vars.blankLines++
+			return
+		}
+		if open != nil && open.continues(o) {
+			vars.blankLines = 0 // The list continues, so the blank lines are dropped.
+		}
+	}
+
+	// With TrimTrailingEmpty, a blank line is held back until it is known whether it is the last line.
+	if vars.opts.TrimTrailingEmpty && blank {
+		vars.blankLines++
+		return
+	}
+
+	// A block embed that is alone on its line is not wrapped in a paragraph.
+	blockEmbed := vars.embedEnd > 0 && vars.embedEnd == vars.tempBuf.Len()
+	vars.embedEnd = 0
+
 	// Close the inline formats opened within the block to the tempBuf and block formats of wrappers to finalBuf.
 	closedTemp := make(formatState, 0, 1)
 
@@ -150,8 +367,8 @@ func (o *Op) writeBlock(vars *renderVars) {
 
 		f := vars.fs[i]
 
-		// If this format is not set on the current Op, close it.
-		if (!f.wrap && !f.fm.HasFormat(o)) || (f.wrap && f.fm.(FormatWrapper).Close(vars.fs, o, true)) {
+		// Close inline formats, which do not continue across blocks, and the formats that are not set on the current Op.
+		if (!f.wrap && (!f.Block || !f.fm.HasFormat(o))) || (f.wrap && f.fm.(FormatWrapper).Close(vars.fs, o, true)) {
 
 			// If we need to close a tag after which there are tags that should stay open, close the following tags for now.
 			if i < len(vars.fs)-1 {
@@ -179,12 +396,24 @@ func (o *Op) writeBlock(vars *renderVars) {
 	closedTemp.writeFormats(&vars.tempBuf)
 	vars.fs = append(vars.fs, closedTemp...) // Copy after the sorting.
 
+	vars.writeBlankLines()
+
+	vars.mapFinal()
+
 	var block struct {
 		tagName string
 		classes []string
 		style   string
+		attrs   string // any other attributes, each preceded by a space
 	}
 
+	openItem := false // whether this is an item of a list that nests items within it, so that it is left open
+	nextItem := false // whether the previous item of such a list is still open
+	codeLine := false // whether this is a line continuing an open code block
+
+	var styles []string
+	tagged := false // whether a format gives the tag name (which may be empty for lines such as those of code blocks)
+
 	// Merge all formats into a single tag.
 	for i := range vars.fms {
 		fm := vars.fms[i]
@@ -193,55 +422,257 @@ func (o *Op) writeBlock(vars *renderVars) {
 			v := fm.Val
 			switch fm.Place {
 			case Tag:
+				if _, ok := fm.fm.(*attributionFormat); ok && !vars.fs.quoteFigureOpen() {
+					v = vars.opts.paragraphTag() // There is no block quote for the attribution to go with.
+				}
 				// If an opening tag is not specified by the Op insert type, it may be specified by an attribute.
 				block.tagName = v // Override whatever value is set.
+				block.classes = append(block.classes, fm.Classes...)
+				tagged = true
 			case Class:
-				block.classes = append(block.classes, v)
+				if v != "" {
+					block.classes = append(block.classes, v)
+				}
+				block.classes = append(block.classes, fm.Classes...)
 			case Style:
-				block.style += v
+				styles = append(styles, v)
 			}
 		}
 		// Write out all of FormatWrapper opening text (if there is any).
-		if fm.wrap && fm.fm.(FormatWrapper).Open(vars.fs, o) {
-			fm.Val = fm.wrapPre
-			vars.fs.add(fm)
-			vars.finalBuf.WriteString(fm.Val)
+		if fm.wrap {
+			if fm.fm.(FormatWrapper).Open(vars.fs, o) {
+				fm.Val = fm.wrapPre
+				vars.fs.add(fm)
+				vars.finalBuf.WriteString(fm.Val)
+			} else if lf, ok := fm.fm.(*listFormat); ok && lf.nests() {
+				nextItem = true
+			} else if _, ok := fm.fm.(*codeBlockFormat); ok {
+				codeLine = true
+			}
+			if lf, ok := fm.fm.(*listFormat); ok && lf.nests() {
+				openItem = true
+			}
+		}
+	}
+
+	// The previous item is closed only now because the items indented under it are written within it.
+	if nextItem {
+		vars.finalBuf.WriteString("</li>")
+	}
+
+	// The formats come from a map, so the order of the classes and styles is made consistent.
+	sort.Strings(block.classes)
+	sortStyles(styles)
+	block.style = strings.Join(styles, "")
+
+	// Block classes and styles (such as an alignment) are set on a paragraph if no format gives the block element.
+	if !tagged && (block.classes != nil || block.style != "") {
+		block.tagName = vars.opts.paragraphTag()
+	}
+
+	// Empty elements are removed from each block before it is written so that a line left empty is written like any
+	// other empty line.
+	if vars.opts.StripEmpty {
+		stripped := stripEmptyElements(vars.tempBuf.Bytes(), vars.tempMap)
+		vars.tempBuf.Truncate(len(stripped)) // The stripped text is never longer than the original.
+		copy(vars.tempBuf.Bytes(), stripped)
+	}
+
+	if vars.opts.BlockText != nil {
+		blockType := block.tagName
+		if o.HasAttr("code-block") {
+			blockType = "pre"
+		}
+		if o.Data != "" {
+			vars.mapTemp()
+			vars.tempBuf.WriteString(o.Data)
+			o.Data = ""
 		}
+		transformed := transformText(vars.tempBuf.Bytes(), func(text string) string {
+			return vars.opts.BlockText(blockType, text)
+		}, vars.opts.Escaping)
+		vars.tempBuf.Reset()
+		vars.tempBuf.Write(transformed)
+	}
+
+	if vars.opts.AutoLink && !o.HasAttr("code-block") {
+		linked := vars.autoLink(vars.tempBuf.Bytes())
+		vars.tempBuf.Reset()
+		vars.tempBuf.Write(linked)
 	}
 
 	// Avoid empty paragraphs and "\n" in the output for text blocks.
-	if o.Data == "" && block.tagName == "p" && vars.tempBuf.Len() == 0 {
-		o.Data = "<br>"
+	paragraph := block.tagName == vars.opts.paragraphTag()
+	empty := o.Data == "" && paragraph && vars.tempBuf.Len() == 0
+	if empty {
+		o.Data = vars.opts.emptyParagraph()
 	}
 
+	if blockEmbed && o.Data == "" && paragraph && block.classes == nil && block.style == "" {
+		block.tagName = vars.embedTag
+	}
+
+	var headerID string
+	if (vars.opts.HeaderIDs || vars.opts.HeaderAnchors) && isHeader(block.tagName) {
+		headerID = vars.headerID(plainText(vars.tempBuf.Bytes()) + html.UnescapeString(o.Data))
+		if headerID != "" {
+			block.attrs += " id=" + quoteAttr(headerID)
+		}
+	}
+
+	// Footnote definitions are set aside to be written at the end.
+	out := &vars.finalBuf
+	for _, fm := range vars.fms {
+		if ff, ok := fm.fm.(*footnoteFormat); ok && fm.Block {
+			out = &vars.footnotes
+			block.attrs += " id=" + quoteAttr("fn-"+ff.id)
+		}
+	}
+
+	for _, fm := range vars.fms {
+		switch f := fm.fm.(type) {
+		case *dataAttrsFormat:
+			block.attrs += f.attrs
+		case *blockQuoteFormat:
+			block.attrs += f.citeAttr()
+		case *quoteFigureFormat:
+			block.attrs += f.citeAttr()
+		}
+	}
+
+	if vars.opts.DebugOpIndex {
+		block.attrs += " data-op-index=" + quoteAttr(strconv.Itoa(vars.opIndex))
+	}
+
+	// The white space of code blocks is always kept by the <pre> element.
+	if vars.opts.PreserveWhitespace && block.tagName != "" && !o.HasAttr("code-block") &&
+		significantSpace(plainText(vars.tempBuf.Bytes())+html.UnescapeString(o.Data)) {
+		block.style += "white-space:pre-wrap;"
+	}
+
+	// Plain paragraphs are written without a <p> tag if UnwrapParagraphs is set, with line breaks between them.
+	unwrapped := vars.opts.UnwrapParagraphs && paragraph && block.tagName != "" && block.classes == nil &&
+		block.style == "" && block.attrs == ""
+	if unwrapped {
+		block.tagName = ""
+		if empty {
+			o.Data = ""
+		}
+		if vars.unwrapped {
+			out.WriteString("<br" + vars.opts.voidEnd("br"))
+		}
+	}
+	vars.unwrapped = unwrapped
+
 	if block.tagName != "" {
-		vars.finalBuf.WriteByte('<')
-		vars.finalBuf.WriteString(block.tagName)
-		vars.finalBuf.WriteString(classesList(block.classes))
+		out.WriteByte('<')
+		out.WriteString(block.tagName)
+		if !vars.opts.StyleFirst {
+			out.WriteString(classesList(block.classes))
+		}
 		if block.style != "" {
-			vars.finalBuf.WriteString(" style=")
-			vars.finalBuf.WriteString(strconv.Quote(block.style))
+			out.WriteString(" style=")
+			out.WriteString(quoteAttr(block.style))
+		}
+		if vars.opts.StyleFirst {
+			out.WriteString(classesList(block.classes))
 		}
-		vars.finalBuf.WriteByte('>')
+		out.WriteString(block.attrs)
+		out.WriteByte('>')
+	}
+
+	if vars.opts.HeaderAnchors && headerID != "" {
+		out.WriteString(vars.opts.headerAnchor(headerID))
 	}
 
-	vars.finalBuf.Write(vars.tempBuf.Bytes()) // Copy the temporary buffer to the final output.
+	// The lines of a code block are separated by line feeds.
+	if codeLine {
+		out.WriteByte('\n')
+	}
+	if o.HasAttr("code-block") {
+		out.WriteString(codeIndent(o))
+	}
 
-	vars.finalBuf.WriteString(o.Data) // Copy the data of the current Op (usually just "<br>" or blank).
+	footnote := out != &vars.finalBuf // Footnotes are not mapped.
 
-	if block.tagName != "" {
-		closeTag(&vars.finalBuf, block.tagName)
+	if vars.mapping {
+		if !footnote {
+			for j, m := range vars.tempMap {
+				if j+1 < len(vars.tempMap) && vars.tempMap[j+1].Offset == m.Offset {
+					continue // Nothing written for the op is left (see RenderOptions.StripEmpty).
+				}
+				vars.srcMap = appendMapping(vars.srcMap, out.Len()+m.Offset, m.Op)
+			}
+		}
+		vars.tempMap = vars.tempMap[:0]
+	}
+
+	out.Write(vars.tempBuf.Bytes()) // Copy the temporary buffer to the final output.
+
+	if o.Data != "" && !footnote {
+		vars.mapFinal()
+	}
+	out.WriteString(o.Data) // Copy the data of the current Op (usually just "<br>" or blank).
+
+	if block.tagName != "" && !openItem {
+		closeTag(out, block.tagName)
 	}
 
 	vars.tempBuf.Reset()
 
 }
 
+// headerID gives the ID of a header with the text, made unique within the document by adding a number (as in
+// "usage-1") to an ID already given to another header.
+func (vars *renderVars) headerID(text string) string {
+	slug := vars.opts.headerSlug(text)
+	if slug == "" {
+		return ""
+	}
+	if vars.headerIDs == nil {
+		vars.headerIDs = make(map[string]bool)
+	}
+	id := slug
+	for n := 1; vars.headerIDs[id]; n++ {
+		id = slug + "-" + strconv.Itoa(n)
+	}
+	vars.headerIDs[id] = true
+	return id
+}
+
+// writeBlankLines writes out the empty paragraphs for the blank lines that were held back.
+func (vars *renderVars) writeBlankLines() {
+	for ; vars.blankLines > 0; vars.blankLines-- {
+		if vars.opts.UnwrapParagraphs {
+			if vars.unwrapped {
+				vars.finalBuf.WriteString("<br" + vars.opts.voidEnd("br"))
+			}
+			vars.unwrapped = true
+			continue
+		}
+		tag := vars.opts.paragraphTag()
+		vars.finalBuf.WriteString("<" + tag + ">")
+		vars.finalBuf.WriteString(vars.opts.emptyParagraph())
+		closeTag(&vars.finalBuf, tag)
+	}
+}
+
+// writeFootnotes writes out the list of the footnote definitions collected.
+func (vars *renderVars) writeFootnotes() {
+	if vars.footnotes.Len() > 0 {
+		vars.finalBuf.WriteString(`<ol class="footnotes">`)
+		vars.finalBuf.Write(vars.footnotes.Bytes())
+		vars.finalBuf.WriteString("</ol>")
+	}
+}
+
 // writeInline writes to the temporary buffer.
 func (o *Op) writeInline(vars *renderVars) {
 
 	vars.fs.closePrevious(&vars.tempBuf, o, false)
 
+	vars.mapTemp()
+
 	// Save the formats being written now separately from fs.
 	addNow := make(formatState, 0, len(vars.fms))
 
@@ -260,9 +691,18 @@ func (o *Op) writeInline(vars *renderVars) {
 		}
 	}
 
+	if max := vars.opts.MaxInlineDepth; max > 0 {
+		addNow.limitDepth(vars.fs, max)
+	}
+
 	addNow.writeFormats(&vars.tempBuf)
 	vars.fs = append(vars.fs, addNow...) // Copy after the sorting.
 
+	for _, wr := range vars.writers {
+		wr.Write(&vars.tempBuf)
+	}
+	vars.writers = vars.writers[:0]
+
 	vars.tempBuf.WriteString(o.Data)
 
 }
@@ -272,79 +712,219 @@ func (o *Op) HasAttr(attr string) bool {
 	return o != nil && o.Attrs[attr] != ""
 }
 
+// lineBreaks says if the Op is a text insert of only line breaks, so that its attributes apply to the blocks it ends.
+func (o *Op) lineBreaks() bool {
+	return o.Type == "text" && o.Data != "" && strings.Trim(o.Data, "\n") == ""
+}
+
 // getFormatter returns a formatter based on the keyword (either "text" or "" or an attribute name) and the Op settings.
-// For every Op, first its Type is passed through here as the keyword, and then its attributes.
-func (o *Op) getFormatter(keyword string, customFormats func(string, *Op) Formatter) Formatter {
+// For every Op, first its Type is passed through here as the keyword, and then its attributes. The opts may be nil.
+func (o *Op) getFormatter(keyword string, opts *RenderOptions) Formatter {
 
-	if customFormats != nil {
-		if custom := customFormats(keyword, o); custom != nil {
+	if opts == nil {
+		opts = new(RenderOptions)
+	}
+
+	if custom := o.customFormatter(keyword, opts); custom != nil {
+		return custom
+	}
+
+	return o.builtInFormatter(keyword, opts)
+
+}
+
+// customFormatter gives the Formatter for the keyword from the CustomFormats option or the registered formats, or nil if
+// neither gives one.
+func (o *Op) customFormatter(keyword string, opts *RenderOptions) Formatter {
+	if opts.CustomFormats != nil {
+		if custom := opts.CustomFormats(keyword, o); custom != nil {
 			return custom
 		}
 	}
+	return registeredFormat(keyword, o)
+}
+
+// DefaultFormatter gives the built-in Formatter for the keyword (an insert type or an attribute name) and the Op, as
+// rendered with the default options, or nil if there is no built-in format for them. A CustomFormats function may
+// return it for the ops it does not change to keep the built-in rendering of them; use the DefaultFormatter method of
+// the RenderOptions to keep the rendering as configured by the options.
+func DefaultFormatter(keyword string, o *Op) Formatter {
+	return o.builtInFormatter(keyword, new(RenderOptions))
+}
+
+// DefaultFormatter gives the built-in Formatter for the keyword and the Op as rendered with the options (not including
+// the CustomFormats), or nil if there is no built-in format for them.
+func (opts *RenderOptions) DefaultFormatter(keyword string, o *Op) Formatter {
+	return o.builtInFormatter(keyword, opts)
+}
+
+// builtInFormatter returns the Formatter of the built-in formats for the keyword, or nil if there is none.
+func (o *Op) builtInFormatter(keyword string, opts *RenderOptions) Formatter {
 
 	switch keyword { // This is the list of currently recognized "keywords".
 	case "text":
-		return new(textFormat)
+		return &textFormat{opts.paragraphTag()}
+	case "details":
+		return &detailsFormat{summary: o.Attrs["details"] == "summary"}
+	case "footnote":
+		return &footnoteFormat{o.Attrs["footnote"]}
+	case "formula":
+		return &formulaFormat{o.Data, opts}
+	case "mention":
+		return newMentionFormat(o, opts)
+	case "footnote-ref":
+		return &footnoteRefFormat{o.Data, opts}
+	case "break":
+		return &breakFormat{opts}
+	case "raw":
+		if opts.AllowRawHTML {
+			return &rawHTMLFormat{o.Data}
+		}
 	case "header":
-		return &headerFormat{
-			level: o.Attrs["header"],
+		// A level that does not make a header tag (h1 through h6) is dropped so that it cannot write other markup.
+		if isHeader("h" + o.Attrs["header"]) {
+			return &headerFormat{
+				level: o.Attrs["header"],
+			}
 		}
 	case "list":
+		if !listItem(o) {
+			return nil
+		}
 		lf := &listFormat{
-			indent: indentDepths[o.Attrs["indent"]],
+			lType:  listTag(o),
+			check:  listCheck(o),
+			indent: indentLevel(o),
+			start:  listStart(o),
 		}
-		if o.Attrs["list"] == "bullet" {
-			lf.lType = "ul"
-		} else {
-			lf.lType = "ol"
+		if lf.label = o.Attrs["aria-label"]; lf.label == "" && opts.ListLabel != nil {
+			lf.label = opts.ListLabel(o)
 		}
 		return lf
 	case "blockquote":
-		return new(blockQuoteFormat)
+		var cite string
+		if c := o.Attrs["cite"]; opts.allowedURL(c) {
+			cite = c
+		}
+		if opts.QuoteAttribution {
+			return &quoteFigureFormat{blockQuoteFormat: blockQuoteFormat{cite: cite}}
+		}
+		return &blockQuoteFormat{cite: cite}
+	case "attribution":
+		if opts.QuoteAttribution {
+			return new(attributionFormat)
+		}
 	case "align":
 		return &alignFormat{
-			val: o.Attrs["align"],
+			val:    o.Attrs["align"],
+			prefix: opts.classPrefix(),
+			style:  opts.InlineStyles && textAligns[o.Attrs["align"]],
 		}
+	case "direction":
+		return &directionFormat{o.Attrs["direction"], opts.classPrefix()}
 	case "image":
-		return &imageFormat{
-			src: o.Data,
+		imf := &imageFormat{
+			src:         o.Data,
+			alt:         o.Attrs["alt"],
+			style:       sanitizeStyle(o.Attrs["style"]),
+			placeholder: o.Attrs["placeholder"],
+			width:       imageDimension(o.Attrs["width"]),
+			height:      imageDimension(o.Attrs["height"]),
+			caption:     o.Attrs["caption"],
+			opts:        opts,
+		}
+		if opts.ImagePicture {
+			imf.sources = imageSources(o)
+		}
+		if !o.HasAttr("link") {
+			imf.standalone = opts.StandaloneImages // A linked image stays inline so that the link is written around it.
 		}
+		return imf
+	case "divider":
+		return &dividerFormat{opts}
+	case "section-break":
+		return &sectionBreakFormat{opts}
 	case "link":
 		return &linkFormat{
 			href: o.Attrs["link"],
+			opts: opts,
+		}
+	case "font":
+		if opts.InlineFonts {
+			if family := fontFamily(o.Attrs["font"]); family != "" {
+				return &fontStyleFormat{
+					font:   o.Attrs["font"],
+					family: family,
+				}
+			}
+		} else if o.Attrs["font"] != "" {
+			return &fontFormat{o.Attrs["font"], opts.classPrefix()}
 		}
 	case "bold":
 		return new(boldFormat)
 	case "size":
-		return sizeFormat(o.Attrs["size"])
+		sf := &sizeFormat{size: o.Attrs["size"], prefix: opts.classPrefix()}
+		if cssLength(sf.size) {
+			sf.style = sf.size
+		} else if opts.InlineStyles {
+			sf.style = namedSizes[sf.size]
+		}
+		return sf
 	case "italic":
 		return new(italicFormat)
 	case "underline":
-		return new(underlineFormat)
+		if opts.SemanticTags {
+			return &underlineFormat{"ins"}
+		}
+		return &underlineFormat{"u"}
 	case "color":
-		return &colorFormat{
-			c: o.Attrs["color"],
+		// Any value that is not a color is dropped so that it cannot end the style and write other CSS.
+		if cssColor(o.Attrs["color"]) {
+			return &colorFormat{
+				c:     o.Attrs["color"],
+				block: o.lineBreaks(),
+			}
 		}
 	case "indent":
-		return &indentFormat{
-			in: o.Attrs["indent"],
+		if level := indentLevel(o); level > 0 {
+			inf := &indentFormat{
+				level:  level,
+				nested: listItem(o) && listCheck(o) != "",
+				prefix: opts.classPrefix(),
+			}
+			if opts.IndentStyle {
+				inf.style = opts.indentStyle(level)
+			}
+			return inf
 		}
 	case "strike":
-		return new(strikeFormat)
+		if opts.SemanticTags {
+			return &strikeFormat{"del"}
+		}
+		return &strikeFormat{"s"}
 	case "background":
-		return &bkgFormat{
-			c: o.Attrs["background"],
+		if cssColor(o.Attrs["background"]) {
+			return &bkgFormat{
+				c:     o.Attrs["background"],
+				block: o.lineBreaks(),
+			}
 		}
 	case "script":
-		sf := new(scriptFormat)
-		if o.Attrs["script"] == "super" {
-			sf.t = "sup"
-		} else {
-			sf.t = "sub"
+		// Any value other than "super" and "sub" is ignored.
+		switch o.Attrs["script"] {
+		case "super":
+			return &scriptFormat{t: "sup", val: "super"}
+		case "sub":
+			return &scriptFormat{t: "sub", val: "sub"}
 		}
-		return sf
+	case "style":
+		if style := sanitizeStyle(o.Attrs["style"]); style != "" {
+			return &styleFormat{style}
+		}
+	case "code":
+		return new(codeFormat)
 	case "code-block":
-		return &codeBlockFormat{o}
+		return &codeBlockFormat{lang: codeLanguage(o), opts: opts}
 	}
 
 	return nil
@@ -366,7 +946,10 @@ type Formatter interface {
 	HasFormat(*Op) bool // Say if the Op has the Format that Fmt returns.
 }
 
-// A FormatWriter can write the body of an Op in a custom way (useful for embeds).
+// A FormatWriter can write the body of an Op in a custom way (useful for embeds). The Fmt method of a FormatWriter
+// typically returns nil, and then the body is written within the inline formats (such as bold) set on the Op. If it
+// returns a Format with Block set, the embed is a block embed: when it is alone on its line, it is not wrapped in a
+// paragraph (but in the element named by the Val of the Format if its Place is Tag).
 type FormatWriter interface {
 	Formatter
 	Write(io.Writer) // Write the entire body of the element.
@@ -386,28 +969,124 @@ type Format struct {
 	Val               string      // the value to print
 	Place             FormatPlace // where this format is placed in the text
 	Block             bool        // indicate whether this is a block-level format (not printed until a "\n" is reached)
+	Classes           []string    // more classes to write with Val for a Place of Class (or the classes of the element for Tag)
 	wrap              bool        // indicates whether this format was written as a FormatWrapper
+	merged            bool        // indicates whether this style was written in the same span as the style before it
 	wrapPre, wrapPost string      // If this Format is a wrap, then Val holds the open and wrapPost holds the close.
 	fm                Formatter   // where this instance of a Format came from
 }
 
+// className gives the value of the class attribute of a format placed in Class: the Val and Classes separated by spaces.
+func (f *Format) className() string {
+	if len(f.Classes) == 0 {
+		return f.Val
+	}
+	cl := strings.Join(f.Classes, " ")
+	if f.Val != "" {
+		cl = f.Val + " " + cl
+	}
+	return cl
+}
+
 // A blankOp can be used to signal any FormatWrapper formats to write the final closing wrap.
 func blankOp() *Op {
-	return &Op{"", "text", make(map[string]string)}
+	return &Op{Type: "text", Attrs: make(map[string]string)}
 }
 
 // If cl has something, then classesList returns the class attribute to add to an HTML element with a space before the
 // "class" attribute and spaces between each class name.
 func classesList(cl []string) string {
 	if len(cl) > 0 {
-		return " class=" + strconv.Quote(strings.Join(cl, " "))
+		return " class=" + quoteAttr(strings.Join(cl, " "))
 	}
 	return ""
 }
 
+// attrEscaper escapes the characters that are not safe within a double-quoted attribute value. Single quotes are
+// left as they are (unlike with html.EscapeString) so that values such as font family lists stay readable.
+var attrEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&#34;")
+
+// quoteAttr escapes an attribute value and surrounds it with double quotes.
+func quoteAttr(val string) string {
+	return `"` + attrEscaper.Replace(val) + `"`
+}
+
 // closeTag writes a complete closing tag to buf.
 func closeTag(buf *bytes.Buffer, tagName string) {
 	buf.WriteString("</")
 	buf.WriteString(tagName)
 	buf.WriteByte('>')
 }
+
+// emptyElements matches inline elements that have no content, with the closing tag of the same element as the opening
+// tag. Void elements such as <br> are never matched.
+var emptyElements = regexp.MustCompile(emptyElementsPattern("a", "b", "code", "del", "em", "i", "ins", "s", "span", "strong",
+	"sub", "sup", "u"))
+
+// emptyElementsPattern gives the pattern matching an empty element of any of the tag names. Each tag name has its own
+// alternative because a regexp cannot require the closing tag name to be the same as the opening one.
+func emptyElementsPattern(tagNames ...string) string {
+	alts := make([]string, len(tagNames))
+	for i, name := range tagNames {
+		alts[i] = `<` + name + `(?:\s[^>]*)?></` + name + `>`
+	}
+	return strings.Join(alts, "|")
+}
+
+// stripEmptyElements removes the inline elements that have no content from html, moving the offsets of the source
+// mappings m for the text removed. Elements that become empty once the empty elements within them are removed are
+// removed too.
+func stripEmptyElements(html []byte, m []SourceMapping) []byte {
+	for {
+		spans := emptyElements.FindAllIndex(html, -1)
+		if spans == nil {
+			return html
+		}
+		cutMappings(m, spans)
+		html = emptyElements.ReplaceAll(html, nil)
+	}
+}
+
+// plainText gives the unescaped text of the HTML without any tags.
+func plainText(h []byte) string {
+	var text strings.Builder
+	transformText(h, func(run string) string {
+		text.WriteString(run)
+		return run
+	}, EscapeNamed)
+	return text.String()
+}
+
+// significantSpace says if the text has white space that HTML collapses: leading spaces, tabs, or runs of spaces.
+func significantSpace(text string) bool {
+	return strings.HasPrefix(text, " ") || strings.Contains(text, "  ") || strings.IndexByte(text, '\t') != -1
+}
+
+// transformText applies fn to the unescaped text of each run of text between the tags in the HTML. The text returned by fn
+// is escaped as esc says. A line feed at the start of a run (separating the lines of a code block) is not passed to fn.
+func transformText(h []byte, fn func(string) string, esc Escaping) []byte {
+	out := make([]byte, 0, len(h))
+	for len(h) > 0 {
+		if h[0] == '<' {
+			end := bytes.IndexByte(h, '>') + 1
+			if end == 0 {
+				end = len(h)
+			}
+			out = append(out, h[:end]...)
+			h = h[end:]
+			continue
+		}
+		end := bytes.IndexByte(h, '<')
+		if end == -1 {
+			end = len(h)
+		}
+		run := h[:end]
+		if run[0] == '\n' {
+			out = append(out, '\n')
+			run = run[1:]
+		}
+		out = append(out, esc.escape(fn(html.UnescapeString(string(run))))...)
+		h = h[end:]
+	}
+	return out
+}
@@ -2,8 +2,11 @@ package quill
 
 import (
 	"bytes"
+	"io"
 	"io/ioutil"
 	"strconv"
+	"strings"
+	"sync"
 	"testing"
 )
 
@@ -49,6 +52,142 @@ func TestSimple(t *testing.T) {
 			ops:  `[{"insert":"text "},{"insert":{"image":"source-url"}},{"insert":" more text\n"}]`,
 			want: `<p>text <img src="source-url"> more text</p>`,
 		},
+		"image placeholder": {
+			ops:  `[{"insert":{"image":"source-url"},"attributes":{"placeholder":"data:image/png;base64,iVBO\"&"}},{"insert":"\n"}]`,
+			want: `<p><img src="source-url" data-placeholder="data:image/png;base64,iVBO&#34;&amp;"></p>`,
+		},
+		"bold across paragraphs (single op)": {
+			ops:  `[{"insert":"one\ntwo","attributes":{"bold":true}},{"insert":"\n"}]`,
+			want: "<p><strong>one</strong></p><p><strong>two</strong></p>",
+		},
+		"bold across paragraphs": {
+			ops:  `[{"insert":"one","attributes":{"bold":true}},{"insert":"\n"},{"insert":"two","attributes":{"bold":true}},{"insert":"\n"}]`,
+			want: "<p><strong>one</strong></p><p><strong>two</strong></p>",
+		},
+		"bold line break": {
+			ops:  `[{"insert":"one","attributes":{"bold":true,"italic":true}},{"insert":"\n","attributes":{"bold":true}},{"insert":"two"},{"insert":"\n"}]`,
+			want: "<p><em><strong>one</strong></em></p><p>two</p>",
+		},
+		"image with a size and alt text": {
+			ops:  `[{"insert":{"image":"cat.png"},"attributes":{"width":"300","height":"200","alt":"A \"cat\" & a dog"}},{"insert":"\n"}]`,
+			want: `<p><img src="cat.png" alt="A &#34;cat&#34; &amp; a dog" width="300" height="200"></p>`,
+		},
+		"image with a style": {
+			ops:  `[{"insert":{"image":"cat.png"},"attributes":{"width":"300","style":"border: 1px solid #ccc; position: absolute"}},{"insert":"\n"}]`,
+			want: `<p><img src="cat.png" width="300" style="border:1px solid #ccc;"></p>`,
+		},
+		"indented paragraph": {
+			ops:  `[{"insert":"text"},{"attributes":{"indent":2},"insert":"\n"}]`,
+			want: `<p class="ql-indent-2">text</p>`,
+		},
+		"indented blockquote": {
+			ops:  `[{"insert":"quote"},{"attributes":{"blockquote":true,"indent":2},"insert":"\n"}]`,
+			want: `<blockquote class="ql-indent-2">quote</blockquote>`,
+		},
+		"CRLF line endings": {
+			ops:  `[{"insert":"one\r\ntwo\r\n\r\nthree\rfour"},{"insert":"\r\n","attributes":{"align":"center"}},{"insert":"a"},{"insert":"\r\n","attributes":{"code-block":true}},{"insert":"b"},{"insert":"\r\n","attributes":{"code-block":true}}]`,
+			want: "<p>one</p><p>two</p><p><br></p><p>three</p><p class=\"ql-align-center\">four</p><pre class=\"ql-syntax\">a\nb\n</pre>",
+		},
+		"soft line break": {
+			ops:  `[{"insert":"first line"},{"insert":{"break":true}},{"insert":"second line\n"}]`,
+			want: `<p>first line<br>second line</p>`,
+		},
+		"soft line break within bold text": {
+			ops:  `[{"insert":"one","attributes":{"bold":true}},{"insert":{"break":true},"attributes":{"bold":true}},{"insert":"two","attributes":{"bold":true}},{"insert":"\n"}]`,
+			want: `<p><strong>one<br>two</strong></p>`,
+		},
+		"image with a caption": {
+			ops:  `[{"insert":{"image":"cat.png"},"attributes":{"caption":"A <cat>","alt":"cat"}},{"insert":"\n"}]`,
+			want: `<figure><img src="cat.png" alt="cat"><figcaption>A &lt;cat&gt;</figcaption></figure>`,
+		},
+		"image without a caption": {
+			ops:  `[{"insert":{"image":"cat.png"},"attributes":{"alt":"cat"}},{"insert":"\n"}]`,
+			want: `<p><img src="cat.png" alt="cat"></p>`,
+		},
+		"image between bold runs": {
+			ops:  `[{"insert":"bold","attributes":{"bold":true}},{"insert":{"image":"x.png"}},{"insert":"bold2","attributes":{"bold":true}},{"insert":"\n"}]`,
+			want: `<p><strong>bold</strong><img src="x.png"><strong>bold2</strong></p>`,
+		},
+		"bold image after bold text": {
+			ops:  `[{"insert":"bold","attributes":{"bold":true}},{"insert":{"image":"x.png"},"attributes":{"bold":true}},{"insert":"\n"}]`,
+			want: `<p><strong>bold<img src="x.png"></strong></p>`,
+		},
+		"bold image": {
+			ops:  `[{"insert":"plain "},{"insert":{"image":"x.png"},"attributes":{"bold":true}},{"insert":"\n"}]`,
+			want: `<p>plain <strong><img src="x.png"></strong></p>`,
+		},
+		"superscripted link": {
+			ops:  `[{"insert":"Text"},{"insert":"1","attributes":{"script":"super","link":"#fn1"}},{"insert":"\n"}]`,
+			want: `<p>Text<a href="#fn1" target="_blank"><sup>1</sup></a></p>`,
+		},
+		"link continued by ops with other formats": {
+			ops:  `[{"insert":"see ","attributes":{"link":"#x"}},{"insert":"1","attributes":{"link":"#x","script":"super"}},{"insert":"2","attributes":{"link":"#x","script":"super"}},{"insert":"3","attributes":{"script":"super"}},{"insert":"\n"}]`,
+			want: `<p><a href="#x" target="_blank">see <sup>12</sup></a><sup>3</sup></p>`,
+		},
+		"blockquote without a citation": {
+			ops:  `[{"insert":"quote"},{"attributes":{"blockquote":true},"insert":"\n"}]`,
+			want: `<blockquote>quote</blockquote>`,
+		},
+		"blockquote with a citation": {
+			ops:  `[{"insert":"quote"},{"attributes":{"blockquote":true,"cite":"https://example.com/\"speech\""},"insert":"\n"}]`,
+			want: `<blockquote cite="https://example.com/&#34;speech&#34;">quote</blockquote>`,
+		},
+		"blockquote with a citation that is not allowed": {
+			ops:  `[{"insert":"quote"},{"attributes":{"blockquote":true,"cite":"javascript:alert(1)"},"insert":"\n"}]`,
+			want: `<blockquote>quote</blockquote>`,
+		},
+		"aligned paragraph": {
+			ops:  `[{"insert":"centered"},{"attributes":{"align":"center"},"insert":"\n"}]`,
+			want: `<p class="ql-align-center">centered</p>`,
+		},
+		"aligned empty line": {
+			ops:  `[{"insert":"\n","attributes":{"align":"right"}}]`,
+			want: `<p class="ql-align-right"><br></p>`,
+		},
+		"indented header": {
+			ops:  `[{"insert":"Title"},{"attributes":{"header":2,"indent":1},"insert":"\n"}]`,
+			want: `<h2 class="ql-indent-1">Title</h2>`,
+		},
+		"indented and aligned blockquote": {
+			ops:  `[{"insert":"quote"},{"attributes":{"blockquote":true,"indent":2,"align":"center"},"insert":"\n"}]`,
+			want: `<blockquote class="ql-align-center ql-indent-2">quote</blockquote>`,
+		},
+		"deeply indented paragraph": {
+			ops:  `[{"insert":"text"},{"attributes":{"indent":8},"insert":"\n"}]`,
+			want: `<p class="ql-indent-8">text</p>`,
+		},
+		"deeply indented list item": {
+			ops:  `[{"insert":"top"},{"attributes":{"list":"bullet"},"insert":"\n"},{"insert":"deep"},{"attributes":{"indent":8,"list":"bullet"},"insert":"\n"}]`,
+			want: `<ul><li>top</li><li class="ql-indent-8">deep</li></ul>`,
+		},
+		"invalid indent": {
+			ops:  `[{"insert":"text"},{"attributes":{"indent":"-1"},"insert":"\n"}]`,
+			want: `<p>text</p>`,
+		},
+		"header with attributes": {
+			ops:  `[{"insert":"x"},{"attributes":{"header":"1 onclick=alert(1)"},"insert":"\n"}]`,
+			want: `<p>x</p>`,
+		},
+		"header level out of range": {
+			ops:  `[{"insert":"x"},{"attributes":{"header":7},"insert":"\n"}]`,
+			want: `<p>x</p>`,
+		},
+		"formula": {
+			ops:  `[{"insert":"Energy is "},{"insert":{"formula":"e=mc^2 \\text{ \"& more\"}"}},{"insert":" in theory.\n"}]`,
+			want: `<p>Energy is <span class="ql-formula" data-value="e=mc^2 \text{ &#34;&amp; more&#34;}">e=mc^2 \text{ &#34;&amp; more&#34;}</span> in theory.</p>`,
+		},
+		"mention": {
+			ops:  `[{"insert":"Thanks, "},{"insert":{"mention":{"id":"1","value":"Jane <J>","denotationChar":"@"}}},{"insert":"!\n"}]`,
+			want: `<p>Thanks, <span class="mention" data-id="1">@Jane &lt;J&gt;</span>!</p>`,
+		},
+		"block style": {
+			ops:  `[{"insert":"styled"},{"attributes":{"style":"color: #a10000; position: fixed; background-image: url(x.png); line-height: 2"},"insert":"\n"}]`,
+			want: `<p style="color:#a10000;line-height:2;">styled</p>`,
+		},
+		"section break": {
+			ops:  `[{"insert":"Part one\n"},{"insert":{"section-break":true}},{"insert":"\nPart two\n"}]`,
+			want: `<p>Part one</p><div class="section-break">* * *</div><p>Part two</p>`,
+		},
 		"background": {
 			ops:  `[{"insert":"abc "},{"attributes":{"background":"#66a3e0"},"insert":"bkg colored"},{"insert":" plain\n"}]`,
 			want: `<p>abc <span style="background-color:#66a3e0;">bkg colored</span> plain</p>`,
@@ -63,6 +202,89 @@ func TestSimple(t *testing.T) {
 				{"insert":"small","attributes":{"size":"small"}},{"insert":"\n"}]`,
 			want: `<p>stuff <span class="ql-size-large">large</span> other <span class="ql-size-small">small</span></p>`,
 		},
+		"size as a length": {
+			ops:  `[{"insert":"pixels","attributes":{"size":"18px"}},{"insert":" "},{"insert":"huge","attributes":{"size":"huge"}},{"insert":"\n"}]`,
+			want: `<p><span style="font-size:18px;">pixels</span> <span class="ql-size-huge">huge</span></p>`,
+		},
+		"font": {
+			ops: `[{"insert":"stuff "},
+				{"insert":"code","attributes":{"font":"monospace"}},{"insert":" other "},
+				{"insert":"serif","attributes":{"font":"serif"}},{"insert":"\n"}]`,
+			want: `<p>stuff <span class="ql-font-monospace">code</span> other <span class="ql-font-serif">serif</span></p>`,
+		},
+		"link with a query string": {
+			ops:  `[{"insert":"search","attributes":{"link":"https://example.com/search?q=go&lang=en&page=2"}},{"insert":"\n"}]`,
+			want: `<p><a href="https://example.com/search?q=go&amp;lang=en&amp;page=2" target="_blank">search</a></p>`,
+		},
+		"link breaking out of the href": {
+			ops:  `[{"insert":"x","attributes":{"link":"https://x.com/?a=1&b=2\"onmouseover="}},{"insert":"\n"}]`,
+			want: `<p><a href="https://x.com/?a=1&amp;b=2&#34;onmouseover=" target="_blank">x</a></p>`,
+		},
+		"color breaking out of the style": {
+			ops:  `[{"insert":"x","attributes":{"color":"red\" onclick=\"alert(1)"}},{"insert":"\n"}]`,
+			want: `<p>x</p>`,
+		},
+		"color breaking out of the style element": {
+			ops:  `[{"insert":"x","attributes":{"color":"red;}</style>","background":"url(evil)"}},{"insert":"\n"}]`,
+			want: `<p>x</p>`,
+		},
+		"rgba and named colors": {
+			ops:  `[{"insert":"x","attributes":{"color":"rgba(255, 0, 0, 0.5)","background":"LightYellow"}},{"insert":"\n"}]`,
+			want: `<p><span style="background-color:LightYellow;color:rgba(255, 0, 0, 0.5);">x</span></p>`,
+		},
+		"size breaking out of the class": {
+			ops:  `[{"insert":"x","attributes":{"size":"huge\" onclick=\"alert(1)"}},{"insert":"\n"}]`,
+			want: `<p><span class="ql-size-huge&#34; onclick=&#34;alert(1)">x</span></p>`,
+		},
+		"image with a query string": {
+			ops:  `[{"insert":{"image":"/img?id=1&size=large"}},{"insert":"\n"}]`,
+			want: `<p><img src="/img?id=1&amp;size=large"></p>`,
+		},
+		"inline code": {
+			ops:  `[{"insert":"Declare "},{"attributes":{"code":true},"insert":"var x"},{"insert":" first.\n"}]`,
+			want: "<p>Declare <code>var x</code> first.</p>",
+		},
+		"code block with a language": {
+			ops:  `[{"insert":"let x = 1;"},{"attributes":{"code-block":"javascript"},"insert":"\n"}]`,
+			want: "<pre class=\"ql-syntax\"><code class=\"language-javascript\">let x = 1;\n</code></pre>",
+		},
+		"code block without a language": {
+			ops:  `[{"insert":"let x = 1;"},{"attributes":{"code-block":true},"insert":"\n"}]`,
+			want: "<pre class=\"ql-syntax\">let x = 1;\n</pre>",
+		},
+		"code block escaping": {
+			ops:  `[{"insert":"<div>"},{"attributes":{"code-block":true},"insert":"\n"},{"insert":"a && b"},{"attributes":{"code-block":true},"insert":"\n"}]`,
+			want: "<pre class=\"ql-syntax\">&lt;div&gt;\na &amp;&amp; b\n</pre>",
+		},
+		"code block with an entity in the text": {
+			ops:  `[{"insert":"x = \"&amp;\""},{"attributes":{"code-block":"html"},"insert":"\n"}]`,
+			want: "<pre class=\"ql-syntax\"><code class=\"language-html\">x = &#34;&amp;amp;&#34;\n</code></pre>",
+		},
+		"indented code block lines": {
+			ops: `[{"insert":"if a {"},{"insert":"\n","attributes":{"code-block":true}},{"insert":"if b {"},` +
+				`{"insert":"\n","attributes":{"code-block":true,"indent":1}},{"insert":"return"},` +
+				`{"insert":"\n","attributes":{"code-block":true,"indent":2}},{"insert":"}"},` +
+				`{"insert":"\n","attributes":{"code-block":true,"indent":1}},{"insert":"}"},{"insert":"\n","attributes":{"code-block":true}}]`,
+			want: "<pre class=\"ql-syntax\">if a {\n    if b {\n        return\n    }\n}\n</pre>",
+		},
+		"inline code escaping": {
+			ops:  `[{"insert":"a && <b>","attributes":{"code":true}},{"insert":"\n"}]`,
+			want: "<p><code>a &amp;&amp; &lt;b&gt;</code></p>",
+		},
+		"block background": {
+			ops:  `[{"insert":"marked","attributes":{"color":"red"}},{"insert":"\n","attributes":{"background":"#ff0","align":"center"}},{"insert":"plain\n"}]`,
+			want: `<p class="ql-align-center" style="background-color:#ff0;"><span style="color:red;">marked</span></p><p>plain</p>`,
+		},
+		"block color": {
+			ops:  `[{"insert":"one\ntwo"},{"insert":"\n","attributes":{"color":"#444"}}]`,
+			want: `<p>one</p><p style="color:#444;">two</p>`,
+		},
+		"ordered list start": {
+			ops: `[{"insert":"one"},{"attributes":{"list":"ordered"},"insert":"\n"},{"insert":"break\nfive"},` +
+				`{"attributes":{"list":"ordered","start":5},"insert":"\n"},{"insert":"six"},{"attributes":{"list":"ordered"},"insert":"\n"},` +
+				`{"insert":"bullet"},{"attributes":{"list":"bullet","start":3},"insert":"\n"}]`,
+			want: `<ol><li>one</li></ol><p>break</p><ol start="5"><li>five</li><li>six</li></ol><ul><li>bullet</li></ul>`,
+		},
 		"superscript": {
 			ops:  `[{"insert":"plain"},{"attributes":{"script":"super"},"insert":"super"},{"insert":"\n"}]`,
 			want: "<p>plain<sup>super</sup></p>",
@@ -71,6 +293,18 @@ func TestSimple(t *testing.T) {
 			ops:  `[{"insert":"plain"},{"attributes":{"script":"sub"},"insert":"sub"},{"insert":"\n"}]`,
 			want: "<p>plain<sub>sub</sub></p>",
 		},
+		"superscript then subscript": {
+			ops:  `[{"attributes":{"script":"super"},"insert":"super"},{"attributes":{"script":"sub"},"insert":"sub"},{"insert":"\n"}]`,
+			want: "<p><sup>super</sup><sub>sub</sub></p>",
+		},
+		"color and background": {
+			ops:  `[{"attributes":{"color":"#444","background":"#ff0"},"insert":"both"},{"attributes":{"background":"#ff0"},"insert":" one"},{"insert":"\n"}]`,
+			want: `<p><span style="background-color:#ff0;color:#444;">both</span><span style="background-color:#ff0;"> one</span></p>`,
+		},
+		"unknown script": {
+			ops:  `[{"insert":"plain"},{"attributes":{"script":"middle"},"insert":"middle"},{"insert":"\n"}]`,
+			want: "<p>plainmiddle</p>",
+		},
 	}
 
 	for k, tc := range cases {
@@ -89,7 +323,7 @@ func TestSimple(t *testing.T) {
 
 func TestRender(t *testing.T) {
 
-	pairNames := []string{"ops1", "nested", "ordering", "list1", "list2", "list3", "list4", "indent", "code1", "code2", "code3"}
+	pairNames := []string{"ops1", "nested", "ordering", "list1", "list2", "list3", "list4", "list5", "list6", "list7", "checklist1", "indent", "code1", "code2", "code3", "code4", "details1", "footnotes1", "rtl1"}
 
 	for _, n := range pairNames {
 		t.Run(n, func(t *testing.T) {
@@ -118,6 +352,73 @@ func TestRender(t *testing.T) {
 
 }
 
+// TestRender_concurrent renders the testdata pairs from many goroutines at once. Run it with -race to check that
+// renderings share no state.
+func TestRender_concurrent(t *testing.T) {
+
+	pairNames := []string{"ops1", "nested", "list3", "list5", "code4", "details1", "footnotes1", "rtl1"}
+
+	ops := make([][]byte, len(pairNames))
+	want := make([][]byte, len(pairNames))
+	for i, n := range pairNames {
+		var err error
+		if ops[i], err = ioutil.ReadFile("./testdata/" + n + ".json"); err != nil {
+			t.Fatalf("could not read %s.json; %s", n, err)
+		}
+		if want[i], err = ioutil.ReadFile("./testdata/" + n + ".html"); err != nil {
+			t.Fatalf("could not read %s.html; %s", n, err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for g := 0; g < 16; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				n := (g + i) % len(pairNames)
+				got, err := Render(ops[n])
+				if err != nil {
+					t.Errorf("error rendering %s; %v", pairNames[n], err)
+					return
+				}
+				if !bytes.Equal(got, want[n]) {
+					t.Errorf("bad rendering of %s:\nwanted: \n%s\ngot: \n%s", pairNames[n], want[n], got)
+					return
+				}
+			}
+		}(g)
+	}
+
+	// Registering a format while rendering must not race with the renderings.
+	RegisterFormat("concurrent-test", func(*Op) Formatter { return nil })
+	defer RegisterFormat("concurrent-test", nil)
+
+	wg.Wait()
+
+}
+
+func TestRender_deterministic(t *testing.T) {
+
+	ops := []byte(`[{"insert":"text","attributes":{"color":"red","background":"#e0e0e0","size":"18px","bold":true,` +
+		`"italic":true}},{"insert":"\n","attributes":{"color":"blue","background":"yellow","align":"center"}}]`)
+
+	want := `<p class="ql-align-center" style="background-color:yellow;color:blue;"><em><strong>` +
+		`<span style="background-color:#e0e0e0;color:red;font-size:18px;">text</span></strong></em></p>`
+
+	// The attributes are decoded into maps, so the rendering must not depend on the order of map iteration.
+	for i := 0; i < 100; i++ {
+		got, err := Render(ops)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Fatalf("(iteration %d) bad rendering; got: %s", i, got)
+		}
+	}
+
+}
+
 func TestClassesList(t *testing.T) {
 	cases := []struct {
 		classes []string
@@ -138,11 +439,34 @@ func TestClassesList(t *testing.T) {
 	}
 }
 
+func TestStripEmptyElements(t *testing.T) {
+	cases := []struct {
+		html   string
+		expect string
+	}{
+		{"a<strong></strong>b", "ab"},
+		{`<a href="https://widerwebs.com"><em></em></a>c`, "c"},
+		{"<b></i>", "<b></i>"},
+		{"<b><i></b></i>", "<b><i></b></i>"},
+		{"<s></strong>x<span></span>", "<s></strong>x"},
+		{"<br><img src=\"a.png\">", "<br><img src=\"a.png\">"},
+	}
+	for i, tc := range cases {
+		t.Run("case_"+strconv.Itoa(i), func(t *testing.T) {
+			got := stripEmptyElements([]byte(tc.html), nil)
+			if string(got) != tc.expect {
+				t.Errorf("expected %q but got %q", tc.expect, got)
+			}
+		})
+	}
+}
+
 func BenchmarkRender_ops1(b *testing.B) {
 	bts, err := ioutil.ReadFile("./testdata/ops1.json")
 	if err != nil {
 		b.Fatalf("could not read ops file: %s", err)
 	}
+	b.ReportAllocs()
 	b.ResetTimer()
 	for n := 0; n < b.N; n++ {
 		bts, err := Render(bts)
@@ -152,3 +476,264 @@ func BenchmarkRender_ops1(b *testing.B) {
 		_ = bts
 	}
 }
+
+// videoFormat is a custom embed format that reads the object value of the embed.
+type videoFormat struct {
+	src   string
+	width string
+}
+
+func (*videoFormat) Fmt() *Format { return nil }
+
+func (vf *videoFormat) HasFormat(o *Op) bool {
+	return o.Type == "video"
+}
+
+func (vf *videoFormat) Write(buf io.Writer) {
+	io.WriteString(buf, `<video src=`+quoteAttr(vf.src)+` width=`+quoteAttr(vf.width)+`></video>`)
+}
+
+func TestRenderExtended_objectEmbed(t *testing.T) {
+
+	ops := []byte(`[{"insert":{"video":{"url":"https://example.com/v.mp4","width":300}}},{"insert":"\n"}]`)
+
+	customFormats := func(keyword string, o *Op) Formatter {
+		if keyword == "video" {
+			v, _ := o.RawData.(map[string]interface{})
+			return &videoFormat{src: extractString(v["url"]), width: extractString(v["width"])}
+		}
+		return nil
+	}
+
+	got, err := RenderExtended(ops, customFormats)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `<p><video src="https://example.com/v.mp4" width="300"></video></p>`; string(got) != want {
+		t.Errorf("bad rendering; got: %s", got)
+	}
+
+}
+
+// panicFormat is an embed format with a bug: it panics when the embed has no source.
+type panicFormat struct {
+	src string
+}
+
+func (*panicFormat) Fmt() *Format { return nil }
+
+func (*panicFormat) HasFormat(o *Op) bool { return o.Type == "video" }
+
+func (pf *panicFormat) Write(buf io.Writer) {
+	if pf.src == "" {
+		panic("no source")
+	}
+	io.WriteString(buf, `<video src=`+quoteAttr(pf.src)+`></video>`)
+}
+
+// embeddedPanicFormat gets its methods from panicFormat.
+type embeddedPanicFormat struct {
+	*panicFormat
+}
+
+func TestRenderExtended_formatterPanic(t *testing.T) {
+
+	ops := []byte(`[{"insert":"first\n"},{"insert":{"video":"a.mp4"}},{"insert":"\n"},{"insert":{"video":""}},{"insert":"\n"}]`)
+
+	customFormats := func(keyword string, o *Op) Formatter {
+		if keyword == "video" {
+			return &panicFormat{src: o.Data}
+		}
+		return nil
+	}
+
+	got, err := RenderExtended(ops, customFormats)
+	if want := `<p>first</p><p><video src="a.mp4"></video></p>`; string(got) != want {
+		t.Errorf("bad rendering before the panic; got: %s", got)
+	}
+	if rerr, ok := err.(*RenderError); !ok || rerr.OpIndex != 3 || !strings.Contains(rerr.Reason, "no source") {
+		t.Errorf("bad error; got: %v", err)
+	}
+
+	// A panic in the function giving the formats is recovered from as well.
+	_, err = RenderExtended(ops, func(keyword string, o *Op) Formatter {
+		if keyword == "video" {
+			panic("no formats")
+		}
+		return nil
+	})
+	if rerr, ok := err.(*RenderError); !ok || rerr.OpIndex != 1 {
+		t.Errorf("bad error from a panic in the custom formats; got: %v", err)
+	}
+
+	// A panic is recovered from when the method is promoted from an embedded type and when the type is local.
+	type localFormat struct {
+		embeddedPanicFormat
+	}
+	for name, cf := range map[string]func(string, *Op) Formatter{
+		"embedded": func(keyword string, o *Op) Formatter {
+			if keyword == "video" {
+				return &embeddedPanicFormat{&panicFormat{src: o.Data}}
+			}
+			return nil
+		},
+		"local": func(keyword string, o *Op) Formatter {
+			if keyword == "video" {
+				return localFormat{embeddedPanicFormat{&panicFormat{src: o.Data}}}
+			}
+			return nil
+		},
+	} {
+		_, err = RenderExtended(ops, cf)
+		if rerr, ok := err.(*RenderError); !ok || rerr.OpIndex != 3 || !strings.Contains(rerr.Reason, "no source") {
+			t.Errorf("bad error from a panic in the %s format; got: %v", name, err)
+		}
+	}
+
+	// A panic in code other than a formatter is not hidden.
+	defer func() {
+		if r := recover(); r != "transform" {
+			t.Errorf("the panic from TransformOp was not passed on; got: %v", r)
+		}
+	}()
+	RenderWithOptions(ops, RenderOptions{
+		CustomFormats: customFormats,
+		TransformOp: func(o *Op) {
+			if o.Type == "video" && o.Data == "" {
+				panic("transform")
+			}
+		},
+	})
+	t.Error("the panic from TransformOp was recovered from")
+
+}
+
+// noteFormat marks text blocks with a class but does not give a tag name.
+type noteFormat struct{}
+
+func (*noteFormat) Fmt() *Format { return &Format{Val: "note", Place: Class, Block: true} }
+
+func (*noteFormat) HasFormat(o *Op) bool { return o.Type == "text" }
+
+func TestRenderExtended_untaggedBlock(t *testing.T) {
+
+	ops := []byte(`[{"insert":"centered"},{"attributes":{"align":"center"},"insert":"\n"}]`)
+
+	customFormats := func(keyword string, o *Op) Formatter {
+		if keyword == "text" {
+			return new(noteFormat)
+		}
+		return nil
+	}
+
+	// The classes of the block are set on a paragraph since no format gives the block element.
+	got, err := RenderExtended(ops, customFormats)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `<p class="note ql-align-center">centered</p>`; string(got) != want {
+		t.Errorf("bad rendering; got: %s", got)
+	}
+
+}
+
+// calloutFormat gives a block or a span of text the classes of a callout of a kind.
+type calloutFormat struct {
+	kind  string
+	block bool
+}
+
+func (cf *calloutFormat) Fmt() *Format {
+	return &Format{Place: Class, Classes: []string{"callout", "callout-" + cf.kind}, Block: cf.block}
+}
+
+func (cf *calloutFormat) HasFormat(o *Op) bool { return o.Attrs["callout"] == cf.kind }
+
+func TestRenderExtended_multipleClasses(t *testing.T) {
+
+	ops := []byte(`[{"insert":"Watch "},{"insert":"out","attributes":{"callout":"danger","bold":true}},` +
+		`{"insert":"\n","attributes":{"callout":"warning","align":"center"}}]`)
+
+	customFormats := func(keyword string, o *Op) Formatter {
+		if keyword == "callout" {
+			return &calloutFormat{kind: o.Attrs["callout"], block: o.lineBreaks()}
+		}
+		return nil
+	}
+
+	got, err := RenderExtended(ops, customFormats)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `<p class="callout callout-warning ql-align-center">Watch <strong><span class="callout callout-danger">out</span></strong></p>`
+	if string(got) != want {
+		t.Errorf("bad rendering; got: %s", got)
+	}
+
+}
+
+// externalLinkFormat writes a link to another site with rel="nofollow".
+type externalLinkFormat struct {
+	href string
+}
+
+func (*externalLinkFormat) Fmt() *Format { return new(Format) } // Only a wrapper.
+
+func (*externalLinkFormat) HasFormat(*Op) bool { return false }
+
+func (lf *externalLinkFormat) Wrap() (string, string) {
+	return `<a href=` + quoteAttr(lf.href) + ` rel="nofollow">`, "</a>"
+}
+
+func (*externalLinkFormat) Open(_ []*Format, _ *Op) bool { return true }
+
+func (lf *externalLinkFormat) Close(_ []*Format, o *Op, _ bool) bool {
+	return o.Attrs["link"] != lf.href
+}
+
+func TestDefaultFormatter(t *testing.T) {
+
+	ops := []byte(`[{"insert":"docs","attributes":{"link":"/docs"}},{"insert":" and "},` +
+		`{"insert":"elsewhere","attributes":{"link":"https://example.com"}},{"insert":"\n"}]`)
+
+	customFormats := func(keyword string, o *Op) Formatter {
+		if keyword == "link" {
+			if strings.HasPrefix(o.Attrs["link"], "https://") {
+				return &externalLinkFormat{o.Attrs["link"]}
+			}
+			return DefaultFormatter(keyword, o)
+		}
+		return nil
+	}
+
+	got, err := RenderExtended(ops, customFormats)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `<p><a href="/docs" target="_blank">docs</a> and <a href="https://example.com" rel="nofollow">elsewhere</a></p>`
+	if string(got) != want {
+		t.Errorf("bad rendering; got: %s", got)
+	}
+
+	// The DefaultFormatter method keeps the options.
+	opts := RenderOptions{LinkTarget: "_self"}
+	opts.CustomFormats = func(keyword string, o *Op) Formatter {
+		if keyword == "link" && !strings.HasPrefix(o.Attrs["link"], "https://") {
+			return opts.DefaultFormatter(keyword, o)
+		}
+		return customFormats(keyword, o)
+	}
+	got, err = RenderWithOptions(ops, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = `<p><a href="/docs" target="_self">docs</a> and <a href="https://example.com" rel="nofollow">elsewhere</a></p>`
+	if string(got) != want {
+		t.Errorf("bad rendering with options; got: %s", got)
+	}
+
+	if DefaultFormatter("unknown", blankOp()) != nil {
+		t.Error("got a Formatter for an unknown keyword")
+	}
+
+}
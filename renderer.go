@@ -0,0 +1,56 @@
+package quill
+
+// A Renderer renders Deltas with the Options, reusing its buffers from one rendering to the next. This saves
+// allocations when many Deltas are rendered one after another. The zero value is ready to use with the default options.
+// A Renderer is not safe for concurrent use; use a Renderer per goroutine (or a sync.Pool of them) instead.
+type Renderer struct {
+	Options RenderOptions
+	vars    *renderVars
+}
+
+// Render takes a Delta array of insert operations and returns the HTML rendered according to r.Options.
+// If an error occurs while rendering, any HTML already rendered is returned.
+// The HTML is returned in the buffer of the Renderer without being copied, so it is valid only until the next call of
+// Render; copy it to keep it longer.
+func (r *Renderer) Render(ops []byte) ([]byte, error) {
+	if r.vars == nil {
+		r.vars = newRenderVars(&r.Options)
+	} else {
+		r.vars.reset(&r.Options)
+	}
+	return r.vars.render(ops)
+}
+
+// reset clears the state of a rendering so that the renderVars can be used again with the options. Every field is set
+// as newRenderVars sets it, except that the buffers and slices keep their memory and the parsed templates are kept (they
+// are looked up by their text, so they stay right if the options change).
+func (vars *renderVars) reset(opts *RenderOptions) {
+	vars.finalBuf.Reset()
+	vars.tempBuf.Reset()
+	vars.fs = vars.fs[:0]
+	vars.fms = vars.fms[:0]
+	vars.writers = vars.writers[:0]
+	for attr := range vars.o.Attrs {
+		delete(vars.o.Attrs, attr)
+	}
+	vars.o = Op{Attrs: vars.o.Attrs}
+	vars.opIndex = 0
+	vars.opts = opts
+	vars.embedEnd = 0
+	vars.embedTag = ""
+	vars.blankLines = 0
+	for id := range vars.headerIDs {
+		delete(vars.headerIDs, id)
+	}
+	vars.rooted = false
+	vars.unwrapped = false
+	vars.footnotes.Reset()
+	vars.w = nil
+	vars.warnings = nil
+	vars.ignored = vars.ignored[:0]
+	vars.unknown = vars.unknown[:0]
+	vars.mapping = false
+	vars.srcMap = nil
+	vars.tempMap = vars.tempMap[:0]
+	vars.customErr = nil
+}
@@ -0,0 +1,115 @@
+package quill
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func TestRenderer_Render(t *testing.T) {
+
+	var r Renderer
+
+	// The same Renderer renders each Delta just like Render does.
+	for _, n := range []string{"ops1", "list4", "code1", "footnotes1", "ops1"} {
+
+		ops, err := ioutil.ReadFile("./testdata/" + n + ".json")
+		if err != nil {
+			t.Fatalf("could not read %s.json; %s", n, err)
+		}
+
+		want, err := Render(ops)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := r.Render(ops)
+		if err != nil {
+			t.Fatalf("(%s) %s", n, err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("(%s) bad rendering; \nexpected: \n%s\ngot: \n%s\n", n, want, got)
+		}
+
+	}
+
+	// A rendering that stops with an error does not affect the next.
+	if _, err := r.Render([]byte(`[{"insert":"bold","attributes":{"bold":true}},{"insert":3}]`)); err == nil {
+		t.Error("no error for a bad op")
+	}
+	got, err := r.Render([]byte(`[{"insert":"plain\n"}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "<p>plain</p>"; string(got) != want {
+		t.Errorf("bad rendering after an error; got: %s", got)
+	}
+
+	r.Options.EmptyParagraph = EmptyNbsp
+	got, err = r.Render([]byte(`[{"insert":"\n"}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "<p>&nbsp;</p>"; string(got) != want {
+		t.Errorf("options not used; got: %s", got)
+	}
+
+}
+
+func TestRenderer_Render_afterError(t *testing.T) {
+
+	r := Renderer{Options: RenderOptions{
+		HeaderIDs:            true,
+		PreserveUnknownAttrs: true,
+		MergeLists:           true,
+		CustomFormats: func(keyword string, o *Op) Formatter {
+			if keyword == "video" {
+				return &panicFormat{src: o.Data}
+			}
+			return nil
+		},
+	}}
+
+	// The rendering stops within a list, with a header ID given and the attributes of the op being rendered collected.
+	bad := []byte(`[{"insert":"Title"},{"attributes":{"header":1},"insert":"\n"},{"insert":"item"},` +
+		`{"attributes":{"list":"bullet"},"insert":"\n"},{"insert":"\n"},{"attributes":{"data-x":"1"},"insert":"a"},` +
+		`{"attributes":{"data-y":"2"},"insert":{"video":""}},{"insert":"\n"}]`)
+	if _, err := r.Render(bad); err == nil {
+		t.Fatal("no error from the panic")
+	}
+
+	ops := []byte(`[{"insert":"Title"},{"attributes":{"header":1},"insert":"\n"},{"insert":"plain\n"}]`)
+	want, err := RenderWithOptions(ops, r.Options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := r.Render(ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("bad rendering after an error; \nexpected: \n%s\ngot: \n%s\n", want, got)
+	}
+
+	// The HTML is returned in the buffer of the Renderer.
+	if &got[0] != &r.vars.finalBuf.Bytes()[0] {
+		t.Error("the HTML was copied")
+	}
+
+}
+
+func BenchmarkRenderer_Render_ops1(b *testing.B) {
+	bts, err := ioutil.ReadFile("./testdata/ops1.json")
+	if err != nil {
+		b.Fatalf("could not read ops file: %s", err)
+	}
+	var r Renderer
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		if _, err := r.Render(bts); err != nil {
+			b.Errorf("error rendering: %s", err)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package quill
+
+import "errors"
+
+// A SourceMapping ties a position in the rendered HTML to the Delta op from which the output starting there is written.
+type SourceMapping struct {
+	Offset int // the byte offset in the rendered HTML
+	Op     int // the index of the op in the Delta array
+}
+
+// RenderWithSourceMap renders a Delta like RenderWithOptions but also returns a source map of the output. The mappings
+// are sorted by Offset, and each one marks the start of a run of output written for the op, so the op that produced any
+// byte of the HTML is given by the last mapping with an Offset not greater than the position of the byte. A block element
+// is mapped to the op holding the "\n" that terminates the block.
+// If an error occurs while rendering, any HTML already rendered is returned along with its mappings.
+// The AutoLink, BlockText, and Sanitizer options rewrite the text of the output in ways that the mappings cannot follow,
+// so an error is returned without rendering if any of them is set.
+func RenderWithSourceMap(ops []byte, opts RenderOptions) ([]byte, []SourceMapping, error) {
+	if opts.AutoLink || opts.BlockText != nil || opts.Sanitizer != nil {
+		return nil, nil, errors.New("quill: a source map cannot be made with the AutoLink, BlockText, or Sanitizer option")
+	}
+	vars := newRenderVars(&opts)
+	vars.mapping = true
+	html, err := vars.render(ops)
+	return html, vars.srcMap, err
+}
+
+// mapTemp records that the text written next to the temporary buffer comes from the current op.
+func (vars *renderVars) mapTemp() {
+	if vars.mapping {
+		vars.tempMap = appendMapping(vars.tempMap, vars.tempBuf.Len(), vars.opIndex)
+	}
+}
+
+// mapFinal records that the text written next to the final buffer comes from the current op.
+func (vars *renderVars) mapFinal() {
+	if vars.mapping {
+		vars.srcMap = appendMapping(vars.srcMap, vars.finalBuf.Len(), vars.opIndex)
+	}
+}
+
+// appendMapping adds a mapping to m unless the last mapping in m is already for the same op.
+func appendMapping(m []SourceMapping, offset, op int) []SourceMapping {
+	if n := len(m); n > 0 && m[n-1].Op == op {
+		return m
+	}
+	return append(m, SourceMapping{Offset: offset, Op: op})
+}
+
+// cutMappings moves the offsets of the mappings for the removal of the spans (sorted and not overlapping, as given by
+// FindAllIndex) from the text that the offsets point into. A mapping within a span removed is moved to where it was.
+func cutMappings(m []SourceMapping, spans [][]int) {
+	for i := range m {
+		cut := 0
+		for _, span := range spans {
+			if m[i].Offset <= span[0] {
+				break
+			}
+			if m[i].Offset < span[1] {
+				cut += m[i].Offset - span[0]
+				break
+			}
+			cut += span[1] - span[0]
+		}
+		m[i].Offset -= cut
+	}
+}
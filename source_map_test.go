@@ -0,0 +1,80 @@
+package quill
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRenderWithSourceMap(t *testing.T) {
+
+	ops := `[{"insert":"Hello "},{"attributes":{"bold":true},"insert":"world"},{"insert":"\n"},{"insert":"Line2\n"},
+		{"insert":"item"},{"attributes":{"list":"bullet"},"insert":"\n"}]`
+
+	html, srcMap, err := RenderWithSourceMap([]byte(ops), RenderOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const wantHTML = "<p>Hello <strong>world</strong></p><p>Line2</p><ul><li>item</li></ul>"
+	if string(html) != wantHTML {
+		t.Fatalf("bad rendering; got: %s", html)
+	}
+
+	want := []SourceMapping{
+		{Offset: 0, Op: 2},  // <p>
+		{Offset: 3, Op: 0},  // Hello
+		{Offset: 9, Op: 1},  // <strong>world
+		{Offset: 35, Op: 3}, // <p>Line2
+		{Offset: 47, Op: 5}, // <ul><li>
+		{Offset: 55, Op: 4}, // item
+	}
+	if !reflect.DeepEqual(srcMap, want) {
+		t.Errorf("bad source map; got %+v", srcMap)
+	}
+
+}
+
+func TestRenderWithSourceMap_stripEmpty(t *testing.T) {
+
+	ops := `[{"insert":"a"},{"attributes":{"bold":true},"insert":""},{"insert":"b"},{"attributes":{"italic":true},"insert":"c"},
+		{"insert":"\n"}]`
+
+	html, srcMap, err := RenderWithSourceMap([]byte(ops), RenderOptions{StripEmpty: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const wantHTML = "<p>ab<em>c</em></p>"
+	if string(html) != wantHTML {
+		t.Fatalf("bad rendering; got: %s", html)
+	}
+
+	want := []SourceMapping{
+		{Offset: 0, Op: 4}, // <p>
+		{Offset: 3, Op: 0}, // a
+		{Offset: 4, Op: 2}, // b (the empty <strong></strong> of op 1 is removed)
+		{Offset: 5, Op: 3}, // <em>c
+	}
+	if !reflect.DeepEqual(srcMap, want) {
+		t.Errorf("bad source map; got %+v", srcMap)
+	}
+
+}
+
+func TestRenderWithSourceMap_rewrites(t *testing.T) {
+
+	ops := []byte(`[{"insert":"see http://a.com "},{"attributes":{"bold":true},"insert":"BOLD"},{"insert":"\n"}]`)
+
+	cases := map[string]RenderOptions{
+		"AutoLink":  {AutoLink: true},
+		"BlockText": {BlockText: func(_, text string) string { return text }},
+		"Sanitizer": {Sanitizer: func(html []byte) []byte { return html }},
+	}
+
+	for name, opts := range cases {
+		if html, srcMap, err := RenderWithSourceMap(ops, opts); err == nil || html != nil || srcMap != nil {
+			t.Errorf("%s: the option was not rejected; got %s and %+v", name, html, srcMap)
+		}
+	}
+
+}
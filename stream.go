@@ -0,0 +1,88 @@
+package quill
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// RenderTo takes a Delta array of insert operations and writes the rendered HTML to w using the built-in settings.
+// The HTML is written as each block element is completed, so the output is not first collected in memory.
+// If an error occurs while rendering or writing, rendering stops; the HTML already written to w is left as is.
+func RenderTo(w io.Writer, ops []byte) error {
+	return RenderToExtended(w, ops, nil)
+}
+
+// RenderToExtended is like RenderTo but accepts a function that may provide a Formatter to customize the way certain
+// kinds of inserts are rendered, as described for RenderExtended.
+func RenderToExtended(w io.Writer, ops []byte, customFormats func(string, *Op) Formatter) error {
+	return RenderToWithOptions(w, ops, RenderOptions{CustomFormats: customFormats})
+}
+
+// RenderToWithOptions is like RenderTo but writes the HTML rendered according to opts. The Sanitizer option cannot be
+// used because it needs all of the HTML at once, so an error is returned without rendering if it is set.
+func RenderToWithOptions(w io.Writer, ops []byte, opts RenderOptions) error {
+	if opts.Sanitizer != nil {
+		return fmt.Errorf("quill: the Sanitizer option cannot be used when rendering to a Writer")
+	}
+	vars := newRenderVars(&opts)
+	vars.w = w
+	_, err := vars.render(ops)
+	return err
+}
+
+// RenderReader is like Render but reads the Delta from r. The ops are decoded one at a time as they are read, so the
+// Delta does not need to be held in memory in full. If the JSON is malformed partway through, the error tells the index
+// of the op that could not be read, and the HTML of the blocks completed before it is returned along with the error.
+func RenderReader(r io.Reader) ([]byte, error) {
+	return RenderReaderExtended(r, nil)
+}
+
+// RenderReaderExtended is like RenderReader but accepts a function that may provide a Formatter to customize the way
+// certain kinds of inserts are rendered, as described for RenderExtended.
+func RenderReaderExtended(r io.Reader, customFormats func(string, *Op) Formatter) ([]byte, error) {
+	return newRenderVars(&RenderOptions{CustomFormats: customFormats}).renderReader(r)
+}
+
+// renderReader decodes the Delta array from r op by op and renders each op as it is decoded.
+func (vars *renderVars) renderReader(r io.Reader) ([]byte, error) {
+
+	dec := json.NewDecoder(r)
+
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '[' {
+		return nil, fmt.Errorf("quill: the Delta is not a JSON array")
+	}
+
+	var ro rawOp
+	for i := 0; dec.More(); i++ {
+		ro = rawOp{}
+		if err = dec.Decode(&ro); err != nil {
+			return vars.finalBuf.Bytes(), &RenderError{OpIndex: i, Reason: "could not be decoded (" + err.Error() + ")"}
+		}
+		if err = vars.renderOp(i, &ro); err != nil {
+			return vars.finalBuf.Bytes(), err
+		}
+	}
+
+	// Read the closing bracket of the array.
+	if _, err = dec.Token(); err != nil {
+		return vars.finalBuf.Bytes(), err
+	}
+
+	return vars.finish()
+
+}
+
+// flush writes out the final buffer if the output is being written to a Writer.
+func (vars *renderVars) flush() error {
+	if vars.w == nil || vars.finalBuf.Len() == 0 {
+		return nil
+	}
+	_, err := vars.w.Write(vars.finalBuf.Bytes())
+	vars.finalBuf.Reset()
+	return err
+}
@@ -0,0 +1,157 @@
+package quill
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestRenderTo(t *testing.T) {
+
+	for _, n := range []string{"ops1", "list1", "code1", "details1"} {
+		t.Run(n, func(t *testing.T) {
+
+			ops, err := ioutil.ReadFile("./testdata/" + n + ".json")
+			if err != nil {
+				t.Fatalf("could not read %s.json; %s", n, err)
+			}
+
+			want, err := Render(ops)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			w := &recordingWriter{}
+			if err = RenderTo(w, ops); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(w.buf.Bytes(), want) {
+				t.Errorf("bad rendering; wanted: %s; got: %s", want, w.buf.Bytes())
+			}
+			if w.writes < 2 {
+				t.Errorf("the output was written in %d writes", w.writes)
+			}
+
+		})
+	}
+
+}
+
+func TestRenderTo_writeError(t *testing.T) {
+
+	ops := []byte(`[{"insert":"one\ntwo\nthree\n"}]`)
+	errWrite := errors.New("write failed")
+
+	w := &recordingWriter{err: errWrite}
+	if err := RenderTo(w, ops); err != errWrite {
+		t.Errorf("got error %v", err)
+	}
+	if w.writes != 1 {
+		t.Errorf("writing went on after an error; %d writes", w.writes)
+	}
+
+	// An error in the ops stops rendering after the blocks already completed are written.
+	w = &recordingWriter{}
+	err := RenderTo(w, []byte(`[{"insert":"one\n"},{"insert":"two\n"},{"insert":3}]`))
+	if err == nil {
+		t.Error("no error for a bad op")
+	}
+	if want := "<p>one</p><p>two</p>"; w.buf.String() != want {
+		t.Errorf("wanted %s written; got: %s", want, w.buf.Bytes())
+	}
+
+}
+
+func TestRenderToWithOptions(t *testing.T) {
+
+	ops := []byte(`[{"insert":"one\n"},{"insert":"two"},{"attributes":{"align":"center"},"insert":"\n"}]`)
+	opts := RenderOptions{RootClass: "content", ClassPrefix: "x-"}
+
+	want, err := RenderWithOptions(ops, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := &recordingWriter{}
+	if err = RenderToWithOptions(w, ops, opts); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(w.buf.Bytes(), want) {
+		t.Errorf("bad rendering; wanted: %s; got: %s", want, w.buf.Bytes())
+	}
+
+	// A Sanitizer cannot be given all of the HTML, so it is not allowed.
+	w = &recordingWriter{}
+	opts.Sanitizer = func(html []byte) []byte { return html }
+	if err = RenderToWithOptions(w, ops, opts); err == nil {
+		t.Error("no error with a Sanitizer")
+	}
+	if w.writes != 0 {
+		t.Errorf("the output was written with a Sanitizer set; got: %s", w.buf.Bytes())
+	}
+
+}
+
+// A recordingWriter counts the writes made to it and fails each one with err if it is set.
+type recordingWriter struct {
+	buf    bytes.Buffer
+	writes int
+	err    error
+}
+
+func (rw *recordingWriter) Write(p []byte) (int, error) {
+	rw.writes++
+	if rw.err != nil {
+		return 0, rw.err
+	}
+	return rw.buf.Write(p)
+}
+
+func TestRenderReader(t *testing.T) {
+
+	for _, n := range []string{"ops1", "nested", "list1", "code1"} {
+		t.Run(n, func(t *testing.T) {
+
+			ops, err := ioutil.ReadFile("./testdata/" + n + ".json")
+			if err != nil {
+				t.Fatalf("could not read %s.json; %s", n, err)
+			}
+
+			want, err := Render(ops)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := RenderReader(strings.NewReader(string(ops)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("bad rendering; wanted: %s; got: %s", want, got)
+			}
+
+		})
+	}
+
+}
+
+func TestRenderReader_malformed(t *testing.T) {
+
+	got, err := RenderReader(strings.NewReader(`[{"insert":"one\ntwo\n"},{"insert":"three"},{"insert":`))
+	if err == nil {
+		t.Fatal("no error for malformed JSON")
+	}
+	if re, ok := err.(*RenderError); !ok || re.OpIndex != 2 {
+		t.Errorf("the error does not give the index of the op: %s", err)
+	}
+	if want := "<p>one</p><p>two</p>"; string(got) != want {
+		t.Errorf("bad partial rendering; wanted: %s; got: %s", want, got)
+	}
+
+	if _, err = RenderReader(strings.NewReader(`{"ops":[]}`)); err == nil {
+		t.Error("no error for a Delta that is not an array")
+	}
+
+}
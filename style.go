@@ -0,0 +1,361 @@
+package quill
+
+import (
+	"strings"
+)
+
+// genericFamilies lists the generic CSS font families, which are written without quotes.
+var genericFamilies = map[string]bool{
+	"serif":      true,
+	"sans-serif": true,
+	"monospace":  true,
+	"cursive":    true,
+	"fantasy":    true,
+	"system-ui":  true,
+}
+
+// fontFamily checks that the comma-separated list of font families is safe to write as a "font-family" style value and
+// returns it in a normalized form. Each family name may contain only letters, digits, spaces, hyphens, and underscores,
+// and it may be surrounded with quotes. If any of the families is not valid, an empty string is returned.
+func fontFamily(list string) string {
+	families := strings.Split(list, ",")
+	for i, f := range families {
+		f = strings.TrimSpace(f)
+		if len(f) > 1 && (f[0] == '"' || f[0] == '\'') && f[len(f)-1] == f[0] {
+			f = strings.TrimSpace(f[1 : len(f)-1])
+		}
+		if f == "" {
+			return ""
+		}
+		quote := false
+		for _, r := range f {
+			switch {
+			case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '-', r == '_':
+			case r >= '0' && r <= '9', r == ' ':
+				quote = true
+			default:
+				return ""
+			}
+		}
+		if quote && !genericFamilies[f] {
+			f = "'" + f + "'"
+		}
+		families[i] = f
+	}
+	return strings.Join(families, ",")
+}
+
+// allowedStyles lists the CSS properties that may be set with the "style" attribute.
+var allowedStyles = map[string]bool{
+	"background-color": true,
+	"border":           true,
+	"border-bottom":    true,
+	"border-color":     true,
+	"border-left":      true,
+	"border-radius":    true,
+	"border-right":     true,
+	"border-style":     true,
+	"border-top":       true,
+	"border-width":     true,
+	"color":            true,
+	"font-size":        true,
+	"font-style":       true,
+	"font-weight":      true,
+	"letter-spacing":   true,
+	"line-height":      true,
+	"margin":           true,
+	"margin-bottom":    true,
+	"margin-left":      true,
+	"margin-right":     true,
+	"margin-top":       true,
+	"padding":          true,
+	"padding-bottom":   true,
+	"padding-left":     true,
+	"padding-right":    true,
+	"padding-top":      true,
+	"text-align":       true,
+	"text-decoration":  true,
+	"text-indent":      true,
+	"text-transform":   true,
+	"white-space":      true,
+	"word-spacing":     true,
+}
+
+// styleFunctions lists the CSS functions that may be used in style values.
+var styleFunctions = map[string]bool{
+	"calc": true,
+	"hsl":  true,
+	"hsla": true,
+	"rgb":  true,
+	"rgba": true,
+}
+
+// sanitizeStyle keeps only the declarations in a style attribute value that set allowed properties to safe values.
+// The declarations kept are each terminated with a semicolon.
+func sanitizeStyle(style string) string {
+	var clean strings.Builder
+	for _, decl := range strings.Split(style, ";") {
+		colon := strings.IndexByte(decl, ':')
+		if colon == -1 {
+			continue
+		}
+		prop := strings.ToLower(strings.TrimSpace(decl[:colon]))
+		val := strings.TrimSpace(decl[colon+1:])
+		if allowedStyles[prop] && safeStyleValue(val) {
+			clean.WriteString(prop)
+			clean.WriteByte(':')
+			clean.WriteString(val)
+			clean.WriteByte(';')
+		}
+	}
+	return clean.String()
+}
+
+// safeStyleValue says if a CSS value contains only plain words, numbers, colors, and allowed functions.
+func safeStyleValue(val string) bool {
+	if val == "" {
+		return false
+	}
+	fnStart := 0 // where the word that may be a function name starts
+	for i, r := range val {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '-':
+		case r >= '0' && r <= '9', r == '#', r == '%', r == '.', r == '+', r == '*', r == '/':
+		case r == ' ', r == ',', r == ')':
+			fnStart = i + 1
+		case r == '(':
+			if !styleFunctions[strings.ToLower(val[fnStart:i])] {
+				return false
+			}
+			fnStart = i + 1
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// textAligns lists the values of the "align" attribute that may be written as a text-align style.
+var textAligns = map[string]bool{
+	"center":  true,
+	"justify": true,
+	"left":    true,
+	"right":   true,
+}
+
+// namedSizes maps the named sizes of the "size" attribute to the font sizes the Quill stylesheets give them.
+var namedSizes = map[string]string{
+	"small": "0.75em",
+	"large": "1.5em",
+	"huge":  "2.5em",
+}
+
+// cssLength says if the value is a plain CSS length with a unit of px, pt, em, rem, or %, such as "18px" or "1.5em".
+func cssLength(val string) bool {
+	var num string
+	for _, unit := range [...]string{"px", "pt", "rem", "em", "%"} {
+		if strings.HasSuffix(val, unit) {
+			num = val[:len(val)-len(unit)]
+			break
+		}
+	}
+	if num == "" {
+		return false
+	}
+	dot := false
+	for i := 0; i < len(num); i++ {
+		switch {
+		case num[i] == '.' && !dot && len(num) > 1:
+			dot = true
+		case num[i] < '0' || num[i] > '9':
+			return false
+		}
+	}
+	return true
+}
+
+// cssColor says if the value is a CSS color that may be written in a style: a hex color (#rgb, #rgba, #rrggbb, or
+// #rrggbbaa), an rgb() or rgba() color of numbers, or one of the named colors.
+func cssColor(val string) bool {
+	val = strings.ToLower(strings.TrimSpace(val))
+	switch {
+	case strings.HasPrefix(val, "#"):
+		switch len(val) {
+		case 4, 5, 7, 9:
+		default:
+			return false
+		}
+		for i := 1; i < len(val); i++ {
+			if c := val[i]; (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+				return false
+			}
+		}
+		return true
+	case strings.HasPrefix(val, "rgb(") || strings.HasPrefix(val, "rgba("):
+		open := strings.IndexByte(val, '(')
+		if !strings.HasSuffix(val, ")") || open+1 == len(val)-1 {
+			return false
+		}
+		for i := open + 1; i < len(val)-1; i++ {
+			if c := val[i]; (c < '0' || c > '9') && strings.IndexByte(" ,./%", c) == -1 {
+				return false
+			}
+		}
+		return true
+	}
+	return namedColors[val]
+}
+
+// namedColors lists the CSS named colors (along with currentcolor and transparent).
+var namedColors = map[string]bool{
+	"aliceblue":            true,
+	"antiquewhite":         true,
+	"aqua":                 true,
+	"aquamarine":           true,
+	"azure":                true,
+	"beige":                true,
+	"bisque":               true,
+	"black":                true,
+	"blanchedalmond":       true,
+	"blue":                 true,
+	"blueviolet":           true,
+	"brown":                true,
+	"burlywood":            true,
+	"cadetblue":            true,
+	"chartreuse":           true,
+	"chocolate":            true,
+	"coral":                true,
+	"cornflowerblue":       true,
+	"cornsilk":             true,
+	"crimson":              true,
+	"currentcolor":         true,
+	"cyan":                 true,
+	"darkblue":             true,
+	"darkcyan":             true,
+	"darkgoldenrod":        true,
+	"darkgray":             true,
+	"darkgreen":            true,
+	"darkgrey":             true,
+	"darkkhaki":            true,
+	"darkmagenta":          true,
+	"darkolivegreen":       true,
+	"darkorange":           true,
+	"darkorchid":           true,
+	"darkred":              true,
+	"darksalmon":           true,
+	"darkseagreen":         true,
+	"darkslateblue":        true,
+	"darkslategray":        true,
+	"darkslategrey":        true,
+	"darkturquoise":        true,
+	"darkviolet":           true,
+	"deeppink":             true,
+	"deepskyblue":          true,
+	"dimgray":              true,
+	"dimgrey":              true,
+	"dodgerblue":           true,
+	"firebrick":            true,
+	"floralwhite":          true,
+	"forestgreen":          true,
+	"fuchsia":              true,
+	"gainsboro":            true,
+	"ghostwhite":           true,
+	"gold":                 true,
+	"goldenrod":            true,
+	"gray":                 true,
+	"green":                true,
+	"greenyellow":          true,
+	"grey":                 true,
+	"honeydew":             true,
+	"hotpink":              true,
+	"indianred":            true,
+	"indigo":               true,
+	"ivory":                true,
+	"khaki":                true,
+	"lavender":             true,
+	"lavenderblush":        true,
+	"lawngreen":            true,
+	"lemonchiffon":         true,
+	"lightblue":            true,
+	"lightcoral":           true,
+	"lightcyan":            true,
+	"lightgoldenrodyellow": true,
+	"lightgray":            true,
+	"lightgreen":           true,
+	"lightgrey":            true,
+	"lightpink":            true,
+	"lightsalmon":          true,
+	"lightseagreen":        true,
+	"lightskyblue":         true,
+	"lightslategray":       true,
+	"lightslategrey":       true,
+	"lightsteelblue":       true,
+	"lightyellow":          true,
+	"lime":                 true,
+	"limegreen":            true,
+	"linen":                true,
+	"magenta":              true,
+	"maroon":               true,
+	"mediumaquamarine":     true,
+	"mediumblue":           true,
+	"mediumorchid":         true,
+	"mediumpurple":         true,
+	"mediumseagreen":       true,
+	"mediumslateblue":      true,
+	"mediumspringgreen":    true,
+	"mediumturquoise":      true,
+	"mediumvioletred":      true,
+	"midnightblue":         true,
+	"mintcream":            true,
+	"mistyrose":            true,
+	"moccasin":             true,
+	"navajowhite":          true,
+	"navy":                 true,
+	"oldlace":              true,
+	"olive":                true,
+	"olivedrab":            true,
+	"orange":               true,
+	"orangered":            true,
+	"orchid":               true,
+	"palegoldenrod":        true,
+	"palegreen":            true,
+	"paleturquoise":        true,
+	"palevioletred":        true,
+	"papayawhip":           true,
+	"peachpuff":            true,
+	"peru":                 true,
+	"pink":                 true,
+	"plum":                 true,
+	"powderblue":           true,
+	"purple":               true,
+	"rebeccapurple":        true,
+	"red":                  true,
+	"rosybrown":            true,
+	"royalblue":            true,
+	"saddlebrown":          true,
+	"salmon":               true,
+	"sandybrown":           true,
+	"seagreen":             true,
+	"seashell":             true,
+	"sienna":               true,
+	"silver":               true,
+	"skyblue":              true,
+	"slateblue":            true,
+	"slategray":            true,
+	"slategrey":            true,
+	"snow":                 true,
+	"springgreen":          true,
+	"steelblue":            true,
+	"tan":                  true,
+	"teal":                 true,
+	"thistle":              true,
+	"tomato":               true,
+	"transparent":          true,
+	"turquoise":            true,
+	"violet":               true,
+	"wheat":                true,
+	"white":                true,
+	"whitesmoke":           true,
+	"yellow":               true,
+	"yellowgreen":          true,
+}
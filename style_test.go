@@ -0,0 +1,100 @@
+package quill
+
+import (
+	"testing"
+)
+
+func TestFontFamily(t *testing.T) {
+	cases := map[string]string{
+		"monospace":                         "monospace",
+		"Georgia, serif":                    "Georgia,serif",
+		`"Times New Roman", 'Open Sans' ,x`: "'Times New Roman','Open Sans',x",
+		"Roboto2":                           "'Roboto2'",
+		"":                                  "",
+		"serif;color:red":                   "",
+		"x;background:url(https://x.com/a)": "",
+		"a,,b":                              "",
+		`"unclosed`:                         "",
+		"it's":                              "",
+		"a</span>":                          "",
+	}
+	for in, want := range cases {
+		if got := fontFamily(in); got != want {
+			t.Errorf("fontFamily(%q): wanted %q but got %q", in, want, got)
+		}
+	}
+}
+
+func TestCSSColor(t *testing.T) {
+	cases := map[string]bool{
+		"#a10000":               true,
+		"#FFF":                  true,
+		"#ff000080":             true,
+		"rgb(255,0,0)":          true,
+		"rgba(255, 0, 0, 0.5)":  true,
+		"RGB(10% 20% 30% / .5)": true,
+		"red":                   true,
+		"LightGoldenrodYellow":  true,
+		"#ff00":                 true,
+		"":                      false,
+		"#ff":                   false,
+		"#ggg":                  false,
+		"rgb()":                 false,
+		"rgb(1,2,3":             false,
+		"rgb(1,2,3);x:y":        false,
+		"hsl(0,100%,50%)":       false,
+		"reddish":               false,
+		"red;}</style>":         false,
+		`red" onclick="x`:       false,
+	}
+	for in, want := range cases {
+		if got := cssColor(in); got != want {
+			t.Errorf("cssColor(%q): wanted %v but got %v", in, want, got)
+		}
+	}
+}
+
+func TestSanitizeStyle(t *testing.T) {
+	cases := map[string]string{
+		"color: red":                       "color:red;",
+		"COLOR:#a10000;Margin-Top: 1.5em;": "color:#a10000;margin-top:1.5em;",
+		"color: rgb(10, 20, 30)":           "color:rgb(10, 20, 30);",
+		"width: calc(100% - 2em)":          "",
+		"padding: calc(100% / 3 - 2em)":    "padding:calc(100% / 3 - 2em);",
+		"background: url(x.png)":           "",
+		"background-color: url(x.png)":     "",
+		"color: expression(alert(1))":      "",
+		"position: fixed; top: 0":          "",
+		`color: red" onclick="x`:           "",
+		"color: red</p><script>":           "",
+		"font-weight:bold;;:;color":        "font-weight:bold;",
+	}
+	for in, want := range cases {
+		if got := sanitizeStyle(in); got != want {
+			t.Errorf("sanitizeStyle(%q): wanted %q but got %q", in, want, got)
+		}
+	}
+}
+
+func TestCSSLength(t *testing.T) {
+	cases := map[string]bool{
+		"18px":    true,
+		"1.5em":   true,
+		".75rem":  true,
+		"120%":    true,
+		"12pt":    true,
+		"huge":    false,
+		"px":      false,
+		".px":     false,
+		"1.2.3em": false,
+		"-2px":    false,
+		"18 px":   false,
+		"18":      false,
+		"9px;x":   false,
+	}
+	for val, want := range cases {
+		if got := cssLength(val); got != want {
+			t.Errorf("cssLength(%q): wanted %v", val, want)
+		}
+	}
+}
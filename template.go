@@ -0,0 +1,123 @@
+package quill
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// A FormatTemplate describes the element written for a format, such as FormatTemplate{Tag: "b"} to write bold text in
+// <b> elements or FormatTemplate{Tag: "h{{.Attrs.header}}", Class: "title"} to give headers a class. Each field is a
+// template in the text/template syntax executed with the Op being rendered, which gives the insert type as .Type, the
+// text (escaped for HTML) or the embed value as .Data, and the attributes as .Attrs (with "y" for true). A missing
+// attribute is an empty string. A format with no Tag is written as a class.
+//
+// A FormatTemplate is meant for formats written as a single element or class (such as bold, header, or an attribute of
+// your own), not for formats that wrap their content (such as lists, links, and code blocks) or for embeds.
+type FormatTemplate struct {
+	Tag   string // the tag name of the element
+	Class string // the class (or classes separated by spaces) of the element
+}
+
+// templateFormat is the format given by a FormatTemplate.
+type templateFormat struct {
+	keyword string
+	val     string // the value of the attribute (empty if the keyword is the insert type)
+	tag     string
+	classes []string
+	block   bool
+}
+
+func (tf *templateFormat) Fmt() *Format {
+	if tf.tag == "" {
+		return &Format{Place: Class, Classes: tf.classes, Block: tf.block}
+	}
+	return &Format{Val: tf.tag, Place: Tag, Classes: tf.classes, Block: tf.block}
+}
+
+func (tf *templateFormat) HasFormat(o *Op) bool {
+	if tf.val == "" {
+		return o.Type == tf.keyword
+	}
+	return o.Attrs[tf.keyword] == tf.val
+}
+
+// templateFormatter gives the Formatter from the FormatTemplates option for the keyword, or nil if there is no template
+// for it. An error is returned if a template cannot be executed or gives a tag name that is not valid.
+func (vars *renderVars) templateFormatter(keyword string) (Formatter, error) {
+
+	ft, ok := vars.opts.FormatTemplates[keyword]
+	if !ok || (keyword != vars.o.Type && !vars.o.HasAttr(keyword)) {
+		return nil, nil
+	}
+
+	tag, err := vars.execTemplate(keyword, ft.Tag)
+	if err != nil {
+		return nil, err
+	}
+	if !validTagName(tag) {
+		return nil, vars.templateError(keyword, fmt.Errorf("gives the tag name %q", tag))
+	}
+	class, err := vars.execTemplate(keyword, ft.Class)
+	if err != nil {
+		return nil, err
+	}
+
+	tf := &templateFormat{keyword: keyword, tag: tag, classes: strings.Fields(class), block: vars.o.lineBreaks()}
+	if keyword != vars.o.Type {
+		tf.val = vars.o.Attrs[keyword]
+	}
+	// The format is a block format if the built-in format it replaces is one.
+	if builtIn := vars.o.builtInFormatter(keyword, vars.opts); builtIn != nil {
+		if fm := builtIn.Fmt(); fm != nil {
+			tf.block = fm.Block
+		}
+	}
+
+	return tf, nil
+
+}
+
+// execTemplate executes the template text for the current op. The parsed templates are kept for the rest of the rendering.
+func (vars *renderVars) execTemplate(keyword, text string) (string, error) {
+
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+
+	t := vars.templates[text]
+	if t == nil {
+		var err error
+		t, err = template.New(keyword).Option("missingkey=zero").Parse(text)
+		if err != nil {
+			return "", vars.templateError(keyword, err)
+		}
+		if vars.templates == nil {
+			vars.templates = make(map[string]*template.Template, 2)
+		}
+		vars.templates[text] = t
+	}
+
+	var out strings.Builder
+	if err := t.Execute(&out, &vars.o); err != nil {
+		return "", vars.templateError(keyword, err)
+	}
+	return out.String(), nil
+
+}
+
+// templateError gives the RenderError for the current op when the template for the keyword fails.
+func (vars *renderVars) templateError(keyword string, err error) error {
+	return &RenderError{OpIndex: vars.opIndex, Reason: fmt.Sprintf("could not be rendered with the template for %q (%s)", keyword, err)}
+}
+
+// validTagName says if the tag name is empty or made of only letters, digits, and hyphens, beginning with a letter.
+func validTagName(tag string) bool {
+	for i := 0; i < len(tag); i++ {
+		c := tag[i]
+		if (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && (i == 0 || c != '-' && (c < '0' || c > '9')) {
+			return false
+		}
+	}
+	return true
+}
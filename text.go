@@ -0,0 +1,35 @@
+package quill
+
+import (
+	"encoding/json"
+	"html"
+	"strings"
+)
+
+// RenderText takes a Delta array of insert operations and returns only the text, without any formatting. The line
+// breaks ending blocks are kept, and each embed (such as an image) is written as a line break.
+// If an error occurs, any text already extracted is returned.
+func RenderText(ops []byte) (string, error) {
+
+	raw := make([]rawOp, 0, 12)
+	if err := json.Unmarshal(ops, &raw); err != nil {
+		return "", err
+	}
+
+	var text strings.Builder
+	o := Op{Attrs: make(map[string]string, 3)}
+
+	for i := range raw {
+		if err := raw[i].makeOp(&o, i); err != nil {
+			return text.String(), err
+		}
+		if o.Type == "text" {
+			text.WriteString(html.UnescapeString(o.Data))
+		} else {
+			text.WriteByte('\n')
+		}
+	}
+
+	return text.String(), nil
+
+}
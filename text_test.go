@@ -0,0 +1,35 @@
+package quill
+
+import (
+	"io/ioutil"
+	"testing"
+)
+
+func TestRenderText(t *testing.T) {
+
+	ops, err := ioutil.ReadFile("./testdata/ops1.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := ioutil.ReadFile("./testdata/ops1.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := RenderText(ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != string(want) {
+		t.Errorf("bad text; \nexpected: \n%s\ngot: \n%s\n", want, got)
+	}
+
+	got, err = RenderText([]byte(`[{"insert":"Tom & \"Jerry\" <3"},{"insert":{"image":"cat.png"}},{"insert":"end\n"}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Tom & \"Jerry\" <3\nend\n"; got != want {
+		t.Errorf("bad text; wanted %q; got %q", want, got)
+	}
+
+}
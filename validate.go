@@ -0,0 +1,72 @@
+package quill
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+// Validate checks that a Delta is well-formed without rendering it: the Delta must be a JSON array in which every op is
+// an object with an insert that is either a string or an object with a single key (an embed), and every attribute value
+// must be a string, a number, a boolean, or null. All of the problems found are returned as a ValidationErrors; if
+// there are none, Validate returns nil.
+func Validate(ops []byte) error {
+
+	var elems []json.RawMessage
+	if err := json.Unmarshal(ops, &elems); err != nil {
+		return err
+	}
+
+	var errs ValidationErrors
+	o := Op{Attrs: make(map[string]string, 3)}
+
+	for i := range elems {
+
+		var ro rawOp
+		if err := json.Unmarshal(elems[i], &ro); err != nil {
+			errs = append(errs, &RenderError{OpIndex: i, Reason: "is not an object"})
+			continue
+		}
+
+		if err := ro.makeOp(&o, i); err != nil {
+			errs = append(errs, err.(*RenderError))
+			continue
+		}
+
+		if embed, ok := ro.Insert.(map[string]interface{}); ok && len(embed) > 1 {
+			errs = append(errs, &RenderError{OpIndex: i, Op: ro, Reason: "has an embed insert with more than one key"})
+		}
+
+		// Check the attributes in order by name so that the errors are always listed in the same order.
+		attrs := make([]string, 0, len(ro.Attrs))
+		for attr := range ro.Attrs {
+			attrs = append(attrs, attr)
+		}
+		sort.Strings(attrs)
+		for _, attr := range attrs {
+			switch ro.Attrs[attr].(type) {
+			case string, float64, bool, nil:
+			default:
+				errs = append(errs, &RenderError{OpIndex: i, Op: ro, Reason: "has a value of an unexpected type for attribute " + attr})
+			}
+		}
+
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+
+}
+
+// ValidationErrors lists the problems found by Validate, in order by op.
+type ValidationErrors []*RenderError
+
+func (errs ValidationErrors) Error() string {
+	msgs := make([]string, len(errs))
+	for i := range errs {
+		msgs[i] = errs[i].Error()
+	}
+	return strings.Join(msgs, "; ")
+}
@@ -0,0 +1,47 @@
+package quill
+
+import (
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+
+	if err := Validate([]byte(`[{"insert":"abc"},{"insert":{"image":"x.png"},"attributes":{"width":"300"}},{"insert":"\n","attributes":{"header":2,"bold":true,"color":null}}]`)); err != nil {
+		t.Errorf("got error for a valid Delta: %s", err)
+	}
+
+	cases := []struct {
+		ops    string
+		errors []int // the indexes of the ops with problems
+	}{
+		{`[{"insert":"abc"},{"attributes":{"bold":true}},{"insert":"\n"}]`, []int{1}},
+		{`[{"insert":{}},{"insert":"abc\n"}]`, []int{0}},
+		{`[{"insert":{"image":"x.png","video":"y.mp4"}}]`, []int{0}},
+		{`[{"insert":"abc","attributes":{"bold":[true]}},"text",{"insert":5},{"insert":"\n"}]`, []int{0, 1, 2}},
+	}
+
+	for i, c := range cases {
+
+		err := Validate([]byte(c.ops))
+		errs, ok := err.(ValidationErrors)
+		if !ok {
+			t.Errorf("(index %d) got error %v", i, err)
+			continue
+		}
+		if len(errs) != len(c.errors) {
+			t.Errorf("(index %d) got %d errors (%s); wanted %d", i, len(errs), errs, len(c.errors))
+			continue
+		}
+		for j := range errs {
+			if errs[j].OpIndex != c.errors[j] {
+				t.Errorf("(index %d) got error for op %d; wanted op %d", i, errs[j].OpIndex, c.errors[j])
+			}
+		}
+
+	}
+
+	if err := Validate([]byte(`{"ops":[]}`)); err == nil {
+		t.Error("no error for a Delta that is not an array")
+	}
+
+}
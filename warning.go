@@ -0,0 +1,96 @@
+package quill
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// A Warning describes something about an op that was not rendered as given, such as an attribute that was ignored.
+type Warning struct {
+	Op      int    // the index of the op in the Delta array
+	Message string // a description of the problem
+}
+
+func (w Warning) String() string {
+	return fmt.Sprintf("op %d: %s", w.Op, w.Message)
+}
+
+// RenderWithWarnings renders a Delta like RenderWithOptions but also returns warnings about any parts of the Delta that
+// were not rendered as given. Warnings do not stop the rendering. If an error occurs while rendering, any HTML already
+// rendered is returned along with the warnings collected.
+func RenderWithWarnings(ops []byte, opts RenderOptions) (html []byte, warnings []Warning, err error) {
+	vars := newRenderVars(&opts)
+	vars.warnings = &warnings
+	html, err = vars.render(ops)
+	return
+}
+
+// warn records a warning about the current op if warnings are being collected.
+func (vars *renderVars) warn(format string, a ...interface{}) {
+	if vars.warnings != nil {
+		*vars.warnings = append(*vars.warnings, Warning{Op: vars.opIndex, Message: fmt.Sprintf(format, a...)})
+	}
+}
+
+// warnIgnored records a warning (in order by name) for each of the ignored attributes of the current op.
+func (vars *renderVars) warnIgnored() {
+	if len(vars.ignored) == 0 {
+		return
+	}
+	sort.Strings(vars.ignored)
+	for _, attr := range vars.ignored {
+		vars.warn("attribute %q is not rendered", attr)
+	}
+	vars.ignored = vars.ignored[:0]
+}
+
+// addUnknown adds the format writing the unknown attributes of the current op as data-* attributes. The attributes of
+// an op holding only line breaks are written on the block element; those of other ops are written on a span.
+func (vars *renderVars) addUnknown() {
+	if len(vars.unknown) == 0 {
+		return
+	}
+	sort.Strings(vars.unknown)
+	names := append([]string(nil), vars.unknown...)
+	if vars.o.lineBreaks() {
+		vars.o.addFmTer(vars, &dataAttrsFormat{names: names, attrs: dataAttrs(&vars.o, names)})
+	} else {
+		vars.o.addFmTer(vars, &dataSpanFormat{names: names, attrs: dataAttrs(&vars.o, names)})
+	}
+	vars.unknown = vars.unknown[:0]
+}
+
+// dataAttrName says if an attribute name may be written as the name of a data-* attribute.
+func dataAttrName(attr string) bool {
+	if attr == "" {
+		return false
+	}
+	for i := 0; i < len(attr); i++ {
+		switch c := attr[i]; {
+		case c >= 'a' && c <= 'z', c >= '0' && c <= '9', c == '-', c == '_', c == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// dataAttrs gives the attributes of o with the names given as data-* attributes, each preceded by a space.
+func dataAttrs(o *Op, names []string) string {
+	var attrs strings.Builder
+	for _, name := range names {
+		attrs.WriteString(" data-" + name + "=" + quoteAttr(o.Attrs[name]))
+	}
+	return attrs.String()
+}
+
+// auxiliaryAttr says if an attribute that has no Formatter of its own is read by the Formatter of another attribute or
+// of the insert type.
+func auxiliaryAttr(attr string) bool {
+	switch attr {
+	case "alt", "aria-label", "placeholder", "width", "height", "start", "cite", "caption":
+		return true
+	}
+	return strings.HasPrefix(attr, "source-")
+}
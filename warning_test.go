@@ -0,0 +1,37 @@
+package quill
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRenderWithWarnings(t *testing.T) {
+
+	ops := []byte(`[{"insert":"text","attributes":{"bold":true,"sparkle":"gold","blink":true,"unset":false}},{"insert":" "},
+		{"insert":{"image":"cat.png"},"attributes":{"placeholder":"x"}},{"insert":"\n"},{"insert":"draft\n","attributes":{"draft":true}}]`)
+
+	opts := RenderOptions{
+		Filter: func(o *Op) bool {
+			return !o.HasAttr("draft")
+		},
+	}
+
+	html, warnings, err := RenderWithWarnings(ops, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := `<p><strong>text</strong> <img src="cat.png" data-placeholder="x"></p>`; string(html) != want {
+		t.Errorf("bad rendering; got: %s", html)
+	}
+
+	want := []Warning{
+		{Op: 0, Message: `attribute "blink" is not rendered`},
+		{Op: 0, Message: `attribute "sparkle" is not rendered`},
+		{Op: 4, Message: "skipped by the filter"},
+	}
+	if !reflect.DeepEqual(warnings, want) {
+		t.Errorf("bad warnings; got %v", warnings)
+	}
+
+}